@@ -0,0 +1,165 @@
+// Command apps manages client applications.
+//
+//	apps -config=./config/config_local.yaml -name=web -redirect-uris=https://web.example.com/callback create
+//	apps -config=./config/config_local.yaml list
+//	apps -config=./config/config_local.yaml -app-id=1 get
+//	apps -config=./config/config_local.yaml -app-id=1 -open=false -client-type=public update
+//	apps -config=./config/config_local.yaml -app-id=1 -client-scopes=users:read update
+//	apps -config=./config/config_local.yaml -app-id=1 rotate-secret
+//	apps -config=./config/config_local.yaml -app-id=1 delete
+//
+// update changes only the settings given as flags. Secrets are printed only
+// by create and rotate-secret. A running server with the HTTP port enabled
+// serves the same operations under /admin/apps. Running servers pick up
+// changes made here once their app cache entries expire, see cache.apps.ttl.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sso/internal/app"
+	"sso/internal/config"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/services/apps"
+	"sso/internal/sl"
+	"strings"
+	"time"
+)
+
+func main() {
+	var (
+		appID          int
+		name           string
+		openMembership bool
+		redirectURIs   string
+		clientType     string
+		clientScopes   string
+		accessTTL      time.Duration
+		refreshTTL     time.Duration
+	)
+
+	flag.IntVar(&appID, "app-id", 0, "app to act on")
+	flag.StringVar(&name, "name", "", "app name")
+	flag.BoolVar(&openMembership, "open", true, "enroll users on their first login")
+	flag.StringVar(&redirectURIs, "redirect-uris", "", "comma separated OAuth2 redirect URIs")
+	flag.StringVar(&clientType, "client-type", models.ClientTypeConfidential, "OAuth2 client type: confidential or public")
+	flag.StringVar(&clientScopes, "client-scopes", "", "comma separated scopes granted to the client credentials grant")
+	flag.DurationVar(&accessTTL, "access-token-ttl", 0, "access token lifetime for the app (0 for the server default)")
+	flag.DurationVar(&refreshTTL, "refresh-token-ttl", 0, "refresh token lifetime for the app (0 for the server default)")
+
+	cfg := config.MustLoad()
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	authStorage, err := storage.NewAuthStorage(cfg.StoragePath)
+	if err != nil {
+		panic(err)
+	}
+
+	box, err := app.SecretBox(log, cfg.Secrets)
+	if err != nil {
+		panic(err)
+	}
+
+	appsService := apps.New(log, authStorage, box)
+	ctx := context.Background()
+
+	settings := models.App{
+		ID:              appID,
+		Name:            name,
+		OpenMembership:  openMembership,
+		RedirectURIs:    splitList(redirectURIs),
+		ClientType:      clientType,
+		ClientScopes:    splitList(clientScopes),
+		AccessTokenTTL:  accessTTL,
+		RefreshTokenTTL: refreshTTL,
+	}
+
+	var result any
+	switch cmd := flag.Arg(0); cmd {
+	case "create":
+		requireFlag(name != "", "name")
+		result, err = appsService.CreateApp(ctx, settings)
+	case "list":
+		result, err = appsService.ListApps(ctx)
+	case "get":
+		requireFlag(appID != 0, "app-id")
+		result, err = appsService.GetApp(ctx, appID)
+	case "update":
+		requireFlag(appID != 0, "app-id")
+		var current models.App
+		if current, err = appsService.GetApp(ctx, appID); err == nil {
+			result, err = appsService.UpdateApp(ctx, withSetFlags(current, settings))
+		}
+	case "rotate-secret":
+		requireFlag(appID != 0, "app-id")
+		var secret string
+		secret, err = appsService.RotateAppSecret(ctx, appID)
+		result = map[string]string{"secret": secret}
+	case "delete":
+		requireFlag(appID != 0, "app-id")
+		err = appsService.DeleteApp(ctx, appID)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: apps [flags] create|list|get|update|rotate-secret|delete")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Error("command failed", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if result != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(result)
+	}
+}
+
+// withSetFlags applies the settings of the flags given on the command line
+// to app, leaving everything else as it is stored.
+func withSetFlags(app, settings models.App) models.App {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			app.Name = settings.Name
+		case "open":
+			app.OpenMembership = settings.OpenMembership
+		case "redirect-uris":
+			app.RedirectURIs = settings.RedirectURIs
+		case "client-type":
+			app.ClientType = settings.ClientType
+		case "client-scopes":
+			app.ClientScopes = settings.ClientScopes
+		case "access-token-ttl":
+			app.AccessTokenTTL = settings.AccessTokenTTL
+		case "refresh-token-ttl":
+			app.RefreshTokenTTL = settings.RefreshTokenTTL
+		}
+	})
+
+	return app
+}
+
+func requireFlag(ok bool, name string) {
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s is required\n", name)
+		os.Exit(2)
+	}
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
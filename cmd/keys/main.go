@@ -0,0 +1,67 @@
+// Command keys manages app signing key rings.
+//
+//	keys -config=./config/config_local.yaml -app-id=1 -alg=RS256 rotate
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sso/internal/app"
+	"sso/internal/config"
+	"sso/internal/domain/storage"
+	"sso/internal/services/auth"
+	"sso/internal/sl"
+	"time"
+)
+
+func main() {
+	var (
+		appID   int
+		alg     string
+		overlap time.Duration
+	)
+
+	flag.IntVar(&appID, "app-id", 0, "app whose key ring is rotated")
+	flag.StringVar(&alg, "alg", auth.AlgRS256, "algorithm of the new key: HS256, RS256 or EdDSA")
+	flag.DurationVar(&overlap, "overlap", 0, "how long the previous key keeps verifying tokens (at least token_ttl)")
+
+	cfg := config.MustLoad()
+
+	if flag.Arg(0) != "rotate" {
+		fmt.Fprintln(os.Stderr, "usage: keys [flags] rotate")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if appID == 0 {
+		fmt.Fprintln(os.Stderr, "app-id is required")
+		os.Exit(2)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	authStorage, err := storage.NewAuthStorage(cfg.StoragePath)
+	if err != nil {
+		panic(err)
+	}
+
+	box, err := app.SecretBox(log, cfg.Secrets)
+	if err != nil {
+		panic(err)
+	}
+
+	authService := auth.New(log, cfg.TokenTTL, cfg.RefreshTTL, nil, authStorage,
+		auth.WithAppSecrets(box),
+		auth.WithSigningKeySecrets(box),
+	)
+
+	kid, err := authService.RotateSigningKey(context.Background(), appID, alg, overlap)
+	if err != nil {
+		log.Error("failed to rotate signing key", sl.Err(err))
+		os.Exit(1)
+	}
+
+	fmt.Println(kid)
+}
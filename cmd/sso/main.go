@@ -22,18 +22,27 @@ func main() {
 
 	log := setupLogger(envLocal)
 
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	application := app.New(log, cfg)
 
 	go func() {
 		application.GRPCServer.MustRun()
 	}()
 
+	if application.HTTPServer != nil {
+		go func() {
+			application.HTTPServer.MustRun()
+		}()
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
 	application.GRPCServer.Stop()
+	if application.HTTPServer != nil {
+		application.HTTPServer.Stop()
+	}
 	log.Info("User service gracefully stopped")
 }
 func setupLogger(env string) *slog.Logger {
@@ -0,0 +1,54 @@
+// Command users runs administrative actions on user accounts.
+//
+//	users -config=./config/config_local.yaml -user-id=1 unlock
+//
+// A running server with the HTTP port enabled serves the same operation
+// under /admin/users/unlock.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sso/internal/config"
+	"sso/internal/domain/storage"
+	"sso/internal/lockout"
+	"sso/internal/services/auth"
+	"sso/internal/sl"
+)
+
+func main() {
+	var userID int64
+
+	flag.Int64Var(&userID, "user-id", 0, "user to act on")
+
+	cfg := config.MustLoad()
+
+	if flag.Arg(0) != "unlock" {
+		fmt.Fprintln(os.Stderr, "usage: users [flags] unlock")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if userID == 0 {
+		fmt.Fprintln(os.Stderr, "user-id is required")
+		os.Exit(2)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	authStorage, err := storage.NewAuthStorage(cfg.StoragePath)
+	if err != nil {
+		panic(err)
+	}
+
+	authService := auth.New(log, cfg.TokenTTL, cfg.RefreshTTL, nil, authStorage,
+		auth.WithLockout(lockout.New(authStorage, lockout.Policy{})),
+	)
+
+	if err := authService.UnlockUser(context.Background(), userID); err != nil {
+		log.Error("failed to unlock user", sl.Err(err))
+		os.Exit(1)
+	}
+}
@@ -1,43 +1,365 @@
 package app
 
 import (
+	"expvar"
+	"fmt"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	grpcapp "sso/internal/app/grpc"
+	httpapp "sso/internal/app/http"
+	"sso/internal/cache"
+	"sso/internal/config"
+	"sso/internal/domain/models"
 	"sso/internal/domain/storage"
+	"sso/internal/domain/storage/memory"
+	"sso/internal/lockout"
+	"sso/internal/mailer"
+	"sso/internal/password"
+	"sso/internal/ratelimit"
+	"sso/internal/secretbox"
+	"sso/internal/services/apps"
 	"sso/internal/services/auth"
 	"sso/internal/services/user"
-	"time"
+	"strings"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
 }
 
 func New(
 	log *slog.Logger,
-	grpcPort int,
-	dsn string,
-	tokenTTL time.Duration,
+	cfg *config.Config,
 ) *App {
 
-	authStorage, err := storage.NewAuthStorage(dsn)
+	authStorage, userStorage, err := openStorage(cfg.StoragePath)
 	if err != nil {
 		panic(err)
 	}
 
-	userStorage, err := storage.NewUserStorage(dsn)
+	caches := cache.New(
+		cache.Limits{Size: cfg.Cache.Apps.Size, TTL: cfg.Cache.Apps.TTL},
+		cache.Limits{Size: cfg.Cache.Users.Size, TTL: cfg.Cache.Users.TTL},
+		cache.Limits{Size: cfg.Cache.Tokens.Size, TTL: cfg.Cache.Tokens.TTL},
+	)
+	expvar.Publish("cache", expvar.Func(func() any { return caches.Stats() }))
+
+	keys, err := signingKeys(log, cfg.Signing)
+	if err != nil {
+		panic(err)
+	}
+
+	box, err := SecretBox(log, cfg.Secrets)
+	if err != nil {
+		panic(err)
+	}
+
+	relyingParty, err := webAuthn(cfg.WebAuthn)
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, tokenTTL, authStorage)
+	passwords, err := passwordPolicy(cfg.Password)
+	if err != nil {
+		panic(err)
+	}
+
+	hasher, err := passwordHasher(cfg.Password.Hash)
+	if err != nil {
+		panic(err)
+	}
+
+	verification, err := tokenVerification(cfg.TokenVerification)
+	if err != nil {
+		panic(err)
+	}
+
+	mailSender, err := mailer.New(log, cfg.Mail.Sender, cfg.Mail.From, cfg.Mail.Dir)
+	if err != nil {
+		panic(err)
+	}
+
+	cachedStorage := cache.NewAuth(authStorage, caches)
+
+	authService := auth.New(log, cfg.TokenTTL, cfg.RefreshTTL, keys, cachedStorage,
+		auth.WithMailer(mailSender),
+		auth.WithActivation(cfg.Activation.RequireForLogin, cfg.Activation.TokenTTL),
+		auth.WithPasswordReset(cfg.PasswordReset.TokenTTL),
+		auth.WithAppSecrets(box),
+		auth.WithSigningKeySecrets(box),
+		auth.WithOAuth(cfg.OAuth.CodeTTL, cfg.OAuth.Issuer),
+		auth.WithMFA(cfg.MFA.Issuer, cfg.MFA.ChallengeTTL, mfaSecrets(log, box)),
+		auth.WithWebAuthn(relyingParty, cfg.WebAuthn.SessionTTL),
+		auth.WithLockout(loginLimiter(cfg.Lockout, authStorage)),
+		auth.WithPasswordPolicy(passwords),
+		auth.WithPasswordHasher(hasher),
+		auth.WithMaxSessionLifetime(cfg.MaxSessionLifetime),
+		verification,
+	)
+
+	appsService := apps.New(log, cachedStorage, box)
 
-	userService := user.New(log, userStorage, tokenTTL)
+	userService := user.New(log, cache.NewUsers(userStorage, caches), cfg.TokenTTL, passwords, hasher, authService)
 
-	grpcApp := grpcapp.New(log, authService, userService, grpcPort)
+	limits, err := rateLimits(cfg.GRPC.RateLimit)
+	if err != nil {
+		panic(err)
+	}
+
+	grpcApp := grpcapp.New(log, authService, userService, authService, limits, cfg.GRPC.Port)
+
+	var httpApp *httpapp.App
+	if cfg.HTTP.Port != 0 {
+		httpApp = httpapp.New(
+			log,
+			authService,
+			authService,
+			authService,
+			userService,
+			authService,
+			authService,
+			authService,
+			authService,
+			authService,
+			appsService,
+			cfg.HTTP.Port,
+			cfg.HTTP.Timeout,
+			cfg.HTTP.DebugVars,
+		)
+	}
 
 	go authStorage.CheckTokens()
 	return &App{
 		GRPCServer: grpcApp,
+		HTTPServer: httpApp,
+	}
+}
+
+// webAuthn returns nil when no relying party is configured, which disables
+// passkeys.
+func webAuthn(cfg config.WebAuthnConfig) (*webauthn.WebAuthn, error) {
+	if cfg.RPID == "" {
+		return nil, nil
 	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+	})
+}
+
+// rateLimits builds the limiters of the gRPC server.
+func rateLimits(cfg config.RateLimitConfig) (grpcapp.RateLimits, error) {
+	limits := grpcapp.RateLimits{Methods: make(map[string]grpcapp.MethodLimit)}
+
+	limit, err := methodLimit(cfg.Default)
+	if err != nil {
+		return grpcapp.RateLimits{}, fmt.Errorf("default rate limit: %w", err)
+	}
+	limits.Default = limit
+
+	for method, rl := range cfg.Methods {
+		limit, err := methodLimit(rl)
+		if err != nil {
+			return grpcapp.RateLimits{}, fmt.Errorf("rate limit of %s: %w", method, err)
+		}
+		if limit == nil {
+			// A method listed without a limit is exempt from the default.
+			limit = &grpcapp.MethodLimit{}
+		}
+		limits.Methods[method] = *limit
+	}
+
+	return limits, nil
+}
+
+// methodLimit returns nil when cfg does not limit calls.
+func methodLimit(cfg config.RateLimit) (*grpcapp.MethodLimit, error) {
+	if cfg.Requests == 0 {
+		return nil, nil
+	}
+	if cfg.Per <= 0 {
+		return nil, fmt.Errorf("per must be positive")
+	}
+
+	key := cfg.Key
+	switch key {
+	case "":
+		key = grpcapp.RateLimitByPeer
+	case grpcapp.RateLimitByPeer, grpcapp.RateLimitByUser, grpcapp.RateLimitByApp:
+	default:
+		return nil, fmt.Errorf("unknown key %q", cfg.Key)
+	}
+
+	return &grpcapp.MethodLimit{
+		Limiter: ratelimit.New(cfg.Requests, cfg.Per, cfg.Burst),
+		Key:     key,
+	}, nil
+}
+
+func passwordPolicy(cfg config.PasswordConfig) (*password.Policy, error) {
+	if cfg.MaxLength <= 0 {
+		return nil, fmt.Errorf("password max_length must be positive")
+	}
+	if cfg.Hash.Algorithm == password.AlgBcrypt && cfg.MaxLength > password.BcryptMaxLength {
+		return nil, fmt.Errorf("password max_length cannot exceed %d with bcrypt", password.BcryptMaxLength)
+	}
+
+	policy := &password.Policy{
+		MinLength:            cfg.MinLength,
+		MaxLength:            cfg.MaxLength,
+		MinCharClasses:       cfg.MinCharClasses,
+		DisallowPersonalInfo: cfg.DisallowPersonalInfo,
+	}
+
+	if cfg.BreachedListDir != "" {
+		list, err := password.NewRangeDir(cfg.BreachedListDir)
+		if err != nil {
+			return nil, fmt.Errorf("breached password list: %w", err)
+		}
+		policy.Breached = list
+	}
+
+	return policy, nil
+}
+
+func passwordHasher(cfg config.PasswordHashConfig) (models.PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case password.AlgBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+
+		return password.Bcrypt{Cost: cfg.BcryptCost}, nil
+	case password.AlgArgon2id:
+		if cfg.Argon2Time == 0 || cfg.Argon2Memory == 0 || cfg.Argon2Threads == 0 {
+			return nil, fmt.Errorf("argon2 parameters must be positive")
+		}
+
+		params := password.DefaultArgon2id
+		params.Time = cfg.Argon2Time
+		params.Memory = cfg.Argon2Memory
+		params.Threads = cfg.Argon2Threads
+
+		return params, nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
+}
+
+func tokenVerification(cfg config.TokenVerificationConfig) (auth.Option, error) {
+	switch cfg.Mode {
+	case auth.VerificationStateful:
+	case auth.VerificationStateless, auth.VerificationHybrid:
+		if cfg.RefreshInterval <= 0 {
+			return nil, fmt.Errorf("token verification refresh_interval must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("unknown token verification mode %q", cfg.Mode)
+	}
+
+	return auth.WithTokenVerification(cfg.Mode, cfg.RefreshInterval), nil
+}
+
+// authStore is the storage of the auth service together with the login
+// counters and the expired token cleanup.
+type authStore interface {
+	cache.AuthStorage
+	lockout.Store
+	CheckTokens()
+}
+
+// openStorage selects the storage by the scheme of storagePath: memory://
+// keeps everything in process memory, anything else is a Postgres
+// connection string.
+func openStorage(storagePath string) (authStore, user.UserProvider, error) {
+	if strings.HasPrefix(storagePath, memory.Scheme+"://") {
+		s, err := memory.Open(storagePath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return s, s, nil
+	}
+
+	authStorage, err := storage.NewAuthStorage(storagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userStorage, err := storage.NewUserStorage(storagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authStorage, userStorage, nil
+}
+
+// loginLimiter returns nil when lockout is disabled.
+func loginLimiter(cfg config.LockoutConfig, store lockout.Store) *lockout.Limiter {
+	if cfg.MaxFailures == 0 {
+		return nil
+	}
+
+	return lockout.New(store, lockout.Policy{
+		MaxFailures:   cfg.MaxFailures,
+		LockDuration:  cfg.LockDuration,
+		BaseDelay:     cfg.BaseDelay,
+		MaxDelay:      cfg.MaxDelay,
+		Window:        cfg.Window,
+		IPMaxFailures: cfg.IPMaxFailures,
+	})
+}
+
+// signingKeys returns nil for HS256, where tokens are signed with the app
+// secret instead of a key pair.
+func signingKeys(log *slog.Logger, cfg config.SigningConfig) (*auth.KeySet, error) {
+	if cfg.Algorithm == auth.AlgHS256 {
+		return nil, nil
+	}
+
+	if cfg.KeyPath == "" {
+		log.Warn("no signing key configured, generating an ephemeral one",
+			slog.String("algorithm", cfg.Algorithm),
+		)
+
+		key, err := auth.GenerateSigningKey(cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		return auth.NewKeySet(key), nil
+	}
+
+	key, err := auth.LoadSigningKey(cfg.Algorithm, cfg.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewKeySet(key), nil
+}
+
+// mfaSecrets refuses to keep TOTP secrets in plaintext: without an
+// encryption key it returns nil, which disables TOTP enrollment.
+func mfaSecrets(log *slog.Logger, box *secretbox.Box) auth.SecretBox {
+	if box == nil {
+		log.Warn("no encryption key configured, two-factor authentication is disabled")
+		return nil
+	}
+
+	return box
+}
+
+// SecretBox returns nil when no encryption key is configured, in which case
+// secrets are stored as they are.
+func SecretBox(log *slog.Logger, cfg config.SecretsConfig) (*secretbox.Box, error) {
+	if cfg.EncryptionKey == "" {
+		log.Warn("no encryption key configured, secrets are stored unencrypted")
+		return nil, nil
+	}
+
+	return secretbox.New(cfg.EncryptionKey)
 }
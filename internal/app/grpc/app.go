@@ -25,6 +25,8 @@ func New(
 	log *slog.Logger,
 	authService authGrpc.Auth,
 	userService userGrpc.User,
+	authenticator Authenticator,
+	rateLimits RateLimits,
 	port int,
 ) *App {
 	loggingOpts := []logging.Option{
@@ -43,7 +45,11 @@ func New(
 
 	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
 		recovery.UnaryServerInterceptor(recoveryOpts...),
+		ClientInfoInterceptor(),
 		logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
+		PeerRateLimitInterceptor(log, rateLimits),
+		AuthInterceptor(log, authenticator),
+		PrincipalRateLimitInterceptor(log, rateLimits),
 	))
 
 	authGrpc.Register(gRPCServer, authService)
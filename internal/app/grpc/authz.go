@@ -0,0 +1,112 @@
+package grpcapp
+
+import (
+	"context"
+	ssov1 "github.com/DarkhanOmirbay/proto/proto/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"sso/internal/authz"
+	"sso/internal/sl"
+	"strings"
+)
+
+// Authenticator returns the caller a token was issued to, with the roles and
+// permissions of its claims. It reports false when the token is not valid.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (authz.Principal, bool, error)
+}
+
+// policy reports whether the principal may call a method with req.
+type policy func(p authz.Principal, req any) bool
+
+// selfOrPermission lets users act on their own account, and callers holding
+// permission (such as admins and services granted it as a scope) act on any
+// account.
+func selfOrPermission(permission string, userID func(req any) int64) policy {
+	return func(p authz.Principal, req any) bool {
+		return p.HasPermission(permission) || (!p.IsService() && p.UserID == userID(req))
+	}
+}
+
+// methodPolicies lists the methods that require an authenticated caller.
+// Methods not listed here are public.
+var methodPolicies = map[string]policy{
+	ssov1.UserProfile_EditProfile_FullMethodName: selfOrPermission(authz.PermUsersWrite, func(req any) int64 {
+		return req.(*ssov1.EditProfileRequest).GetId()
+	}),
+	ssov1.UserProfile_DeleteAccount_FullMethodName: selfOrPermission(authz.PermUsersDelete, func(req any) int64 {
+		return req.(*ssov1.DeleteAccountRequest).GetId()
+	}),
+	ssov1.UserProfile_ShowProfile_FullMethodName: selfOrPermission(authz.PermUsersRead, func(req any) int64 {
+		return req.(*ssov1.ShowProfileRequest).GetId()
+	}),
+}
+
+// AuthInterceptor authenticates the bearer token from the authorization
+// metadata, stores the caller in the context and enforces methodPolicies.
+// Public methods are called anonymously when the token cannot be
+// authenticated.
+func AuthInterceptor(log *slog.Logger, authenticator Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		allowed, protected := methodPolicies[info.FullMethod]
+
+		token := bearerToken(ctx)
+		if token == "" {
+			if protected {
+				return nil, status.Error(codes.Unauthenticated, "authorization token is required")
+			}
+			return handler(ctx, req)
+		}
+
+		principal, ok, err := authenticator.Authenticate(ctx, token)
+		if err != nil {
+			log.Error("failed to authenticate request", slog.String("method", info.FullMethod), sl.Err(err))
+
+			if protected {
+				return nil, status.Error(codes.Internal, "failed to authenticate")
+			}
+			return handler(ctx, req)
+		}
+
+		if !ok {
+			if protected {
+				return nil, status.Error(codes.Unauthenticated, "invalid authorization token")
+			}
+			return handler(ctx, req)
+		}
+
+		if protected && !allowed(principal, req) {
+			log.Warn("permission denied",
+				slog.String("method", info.FullMethod),
+				slog.Int64("user_id", principal.UserID),
+				slog.Int("client_id", principal.ClientID),
+			)
+
+			return nil, status.Error(codes.PermissionDenied, "permission denied")
+		}
+
+		return handler(authz.WithPrincipal(ctx, principal), req)
+	}
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,33 @@
+package grpcapp
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"sso/internal/clientinfo"
+)
+
+// ClientInfoInterceptor stores the peer address and the user-agent
+// metadata of the caller in the context.
+func ClientInfoInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var client clientinfo.Info
+
+		if p, ok := peer.FromContext(ctx); ok {
+			client.IP = p.Addr.String()
+			if host, _, err := net.SplitHostPort(client.IP); err == nil {
+				client.IP = host
+			}
+		}
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("user-agent"); len(values) > 0 {
+				client.UserAgent = values[0]
+			}
+		}
+
+		return handler(clientinfo.With(ctx, client), req)
+	}
+}
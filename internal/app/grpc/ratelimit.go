@@ -0,0 +1,115 @@
+package grpcapp
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"math"
+	"sso/internal/authz"
+	"sso/internal/clientinfo"
+	"sso/internal/ratelimit"
+	"strconv"
+)
+
+// Rate limit keys select whose calls share a bucket.
+const (
+	RateLimitByPeer = "peer"
+	RateLimitByUser = "user"
+	RateLimitByApp  = "app"
+)
+
+// retryAfterTrailer tells a throttled client how many seconds to wait.
+const retryAfterTrailer = "retry-after"
+
+// MethodLimit applies Limiter to the calls of a method. A nil Limiter does
+// not limit them.
+type MethodLimit struct {
+	Limiter *ratelimit.Limiter
+	Key     string
+}
+
+// RateLimits maps full method names to their limit. Default applies to the
+// methods not listed; they are not limited when it is nil.
+type RateLimits struct {
+	Default *MethodLimit
+	Methods map[string]MethodLimit
+}
+
+// PeerRateLimitInterceptor refuses calls over the peer keyed limit of their
+// method with ResourceExhausted. It runs before AuthInterceptor, so floods of
+// calls are refused before their tokens are verified.
+func PeerRateLimitInterceptor(log *slog.Logger, limits RateLimits) grpc.UnaryServerInterceptor {
+	return rateLimitInterceptor(log, limits, func(key string) bool {
+		return key == RateLimitByPeer
+	})
+}
+
+// PrincipalRateLimitInterceptor refuses calls over the user or app keyed
+// limit of their method with ResourceExhausted. It runs after
+// AuthInterceptor so calls can be keyed by the authenticated principal.
+func PrincipalRateLimitInterceptor(log *slog.Logger, limits RateLimits) grpc.UnaryServerInterceptor {
+	return rateLimitInterceptor(log, limits, func(key string) bool {
+		return key != RateLimitByPeer
+	})
+}
+
+// rateLimitInterceptor applies the limits whose key is selected.
+func rateLimitInterceptor(log *slog.Logger, limits RateLimits, selected func(key string) bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		limit, ok := limits.Methods[info.FullMethod]
+		if !ok {
+			if limits.Default == nil {
+				return handler(ctx, req)
+			}
+			limit = *limits.Default
+		}
+		if limit.Limiter == nil || !selected(limit.Key) {
+			return handler(ctx, req)
+		}
+
+		key := rateLimitKey(ctx, limit.Key, req)
+
+		allowed, wait := limit.Limiter.Allow(info.FullMethod + " " + key)
+		if !allowed {
+			log.Warn("rate limit exceeded",
+				slog.String("method", info.FullMethod),
+				slog.String("key", key),
+			)
+
+			seconds := int64(math.Ceil(wait.Seconds()))
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(retryAfterTrailer, strconv.FormatInt(seconds, 10)))
+
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitKey identifies the caller. Calls without a user or app fall back
+// to the peer address.
+func rateLimitKey(ctx context.Context, by string, req any) string {
+	principal, authenticated := authz.PrincipalFromContext(ctx)
+
+	switch by {
+	case RateLimitByUser:
+		if authenticated && !principal.IsService() {
+			return "user:" + strconv.FormatInt(principal.UserID, 10)
+		}
+		if authenticated {
+			return "app:" + strconv.Itoa(principal.ClientID)
+		}
+	case RateLimitByApp:
+		if authenticated && principal.IsService() {
+			return "app:" + strconv.Itoa(principal.ClientID)
+		}
+		if r, ok := req.(interface{ GetAppId() int32 }); ok && r.GetAppId() != 0 {
+			return "app:" + strconv.Itoa(int(r.GetAppId()))
+		}
+	}
+
+	return "peer:" + clientinfo.FromContext(ctx).IP
+}
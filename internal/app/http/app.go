@@ -0,0 +1,121 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sso/internal/clientinfo"
+	accountHttp "sso/internal/http/account"
+	adminHttp "sso/internal/http/admin"
+	appsHttp "sso/internal/http/apps"
+	authHttp "sso/internal/http/auth"
+	mfaHttp "sso/internal/http/mfa"
+	oauthHttp "sso/internal/http/oauth"
+	oidcHttp "sso/internal/http/oidc"
+	passkeyHttp "sso/internal/http/passkey"
+	sessionHttp "sso/internal/http/session"
+	"sso/internal/sl"
+	"time"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(
+	log *slog.Logger,
+	authService authHttp.Auth,
+	oauthService oauthHttp.OAuth,
+	oidcService oidcHttp.OIDC,
+	profileService oidcHttp.Profiles,
+	mfaService mfaHttp.MFA,
+	passkeyService passkeyHttp.Passkeys,
+	sessionService sessionHttp.Sessions,
+	adminService adminHttp.Admin,
+	accountService accountHttp.Account,
+	appsService appsHttp.Apps,
+	port int,
+	timeout time.Duration,
+	debugVars bool,
+) *App {
+	mux := http.NewServeMux()
+
+	authHttp.Register(mux, authService)
+	oauthHttp.Register(mux, log, oauthService)
+	oidcHttp.Register(mux, log, oidcService, profileService)
+	mfaHttp.Register(mux, log, mfaService)
+	passkeyHttp.Register(mux, log, passkeyService)
+	sessionHttp.Register(mux, log, sessionService)
+	adminHttp.Register(mux, log, adminService)
+	accountHttp.Register(mux, log, accountService)
+	appsHttp.Register(mux, log, adminService, appsService)
+	if debugVars {
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:      withClientInfo(mux),
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		},
+		port: port,
+	}
+}
+
+// withClientInfo stores the remote address and the User-Agent header of
+// the client in the request context.
+func withClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientinfo.Info{IP: r.RemoteAddr, UserAgent: r.UserAgent()}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			client.IP = host
+		}
+
+		next.ServeHTTP(w, r.WithContext(clientinfo.With(r.Context(), client)))
+	})
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("http server started", slog.String("addr", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(slog.String("op", op)).
+		Info("stopping HTTP server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.log.Error("failed to stop HTTP server", sl.Err(err))
+	}
+}
@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"context"
+	"slices"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermUsersDelete  = "users:delete"
+	PermRolesManage  = "roles:manage"
+	PermTokensRevoke = "tokens:revoke"
+	PermAppsManage   = "apps:manage"
+)
+
+// Principal is the authenticated caller of a request. Service principals
+// authenticate with a client credentials token: they have a ClientID instead
+// of a UserID, and their granted scopes are their permissions.
+type Principal struct {
+	UserID      int64
+	ClientID    int
+	Roles       []string
+	Permissions []string
+}
+
+func (p Principal) IsService() bool {
+	return p.ClientID != 0
+}
+
+func (p Principal) IsAdmin() bool {
+	return slices.Contains(p.Roles, RoleAdmin)
+}
+
+func (p Principal) HasPermission(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/golang-jwt/jwt/v5"
+	"sso/internal/domain/models"
+	"sso/internal/services/apps"
+	"sso/internal/services/auth"
+	"time"
+)
+
+// AuthStorage is what Auth wraps: the storage of the auth service, which
+// also manages apps.
+type AuthStorage interface {
+	auth.AuthProvider
+	apps.AppProvider
+}
+
+// Auth caches apps, users and authenticated access tokens of AuthStorage.
+// Only successful lookups are cached. Any token revocation drops all cached
+// tokens, since revocations by user or session do not name the tokens. Other
+// processes do not hear of it: they keep accepting a revoked token they
+// have cached until it expires from their token cache.
+type Auth struct {
+	AuthStorage
+	cache *Cache
+}
+
+func NewAuth(storage AuthStorage, cache *Cache) *Auth {
+	return &Auth{AuthStorage: storage, cache: cache}
+}
+
+func (a *Auth) App(ctx context.Context, appID int) (models.App, error) {
+	if app, ok := a.cache.apps.Get(appID); ok {
+		return app, nil
+	}
+
+	app, err := a.AuthStorage.App(ctx, appID)
+	if err != nil {
+		return models.App{}, err
+	}
+	a.cache.apps.Add(appID, app)
+
+	return app, nil
+}
+
+func (a *Auth) UpdateApp(ctx context.Context, app models.App) error {
+	defer a.cache.apps.Remove(app.ID)
+
+	return a.AuthStorage.UpdateApp(ctx, app)
+}
+
+func (a *Auth) UpdateAppSecret(ctx context.Context, appID int, secret string) error {
+	defer a.cache.apps.Remove(appID)
+
+	return a.AuthStorage.UpdateAppSecret(ctx, appID, secret)
+}
+
+func (a *Auth) DeleteApp(ctx context.Context, appID int) error {
+	defer a.cache.apps.Remove(appID)
+
+	return a.AuthStorage.DeleteApp(ctx, appID)
+}
+
+func (a *Auth) GetUserByID(ctx context.Context, userID int64) (models.User, error) {
+	if user, ok := a.cache.users.Get(userID); ok {
+		return user, nil
+	}
+
+	user, err := a.AuthStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	a.cache.users.Add(userID, user)
+
+	return user, nil
+}
+
+// GetUserByEmail goes through the user cached by id. A cached user whose
+// email has changed since is not returned.
+func (a *Auth) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if userID, ok := a.cache.emails.Get(email); ok {
+		if user, ok := a.cache.users.Get(userID); ok && user.Email == email {
+			return user, nil
+		}
+	}
+
+	user, err := a.AuthStorage.GetUserByEmail(ctx, email)
+	if err != nil {
+		return models.User{}, err
+	}
+	a.cache.users.Add(user.ID, user)
+	a.cache.emails.Add(email, user.ID)
+
+	return user, nil
+}
+
+func (a *Auth) UpdatePassword(ctx context.Context, userID int64, passHash []byte) error {
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.UpdatePassword(ctx, userID, passHash)
+}
+
+func (a *Auth) ActivateUser(ctx context.Context, userID int64) error {
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.ActivateUser(ctx, userID)
+}
+
+// AssignRole and the other role changes drop the user, so that cached users
+// never outlive the roles they were read with.
+func (a *Auth) AssignRole(ctx context.Context, userID int64, role string) error {
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.AssignRole(ctx, userID, role)
+}
+
+func (a *Auth) RevokeRole(ctx context.Context, userID int64, role string) error {
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.RevokeRole(ctx, userID, role)
+}
+
+// RemoveAppMember revokes the tokens of the user in the app as well, so
+// the cached tokens go with the cached user.
+func (a *Auth) RemoveAppMember(ctx context.Context, appID int, userID int64) error {
+	defer a.cache.tokens.Purge()
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.RemoveAppMember(ctx, appID, userID)
+}
+
+func (a *Auth) AssignAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.AssignAppRole(ctx, appID, userID, role)
+}
+
+func (a *Auth) RevokeAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	defer a.cache.invalidateUser(userID)
+
+	return a.AuthStorage.RevokeAppRole(ctx, appID, userID, role)
+}
+
+// IsAuthenticated caches authenticated tokens until they expire. The expiry
+// is read from the token, which the storage has just vouched for.
+func (a *Auth) IsAuthenticated(ctx context.Context, token string) (bool, int64, error) {
+	hash := sha256.Sum256([]byte(token))
+	if cached, ok := a.cache.tokens.Get(hash); ok {
+		if time.Now().Before(cached.expiry) {
+			return true, cached.userID, nil
+		}
+		a.cache.tokens.Remove(hash)
+	}
+
+	isAuthenticated, userID, err := a.AuthStorage.IsAuthenticated(ctx, token)
+	if err != nil {
+		return false, 0, err
+	}
+	if isAuthenticated {
+		var claims jwt.RegisteredClaims
+		if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err == nil && claims.ExpiresAt != nil {
+			a.cache.tokens.Add(hash, cachedToken{userID: userID, expiry: claims.ExpiresAt.Time})
+		}
+	}
+
+	return isAuthenticated, userID, nil
+}
+
+func (a *Auth) RevokeToken(ctx context.Context, token string) (string, error) {
+	defer a.cache.tokens.Purge()
+
+	return a.AuthStorage.RevokeToken(ctx, token)
+}
+
+func (a *Auth) RevokeClientToken(ctx context.Context, token string) error {
+	defer a.cache.tokens.Purge()
+
+	return a.AuthStorage.RevokeClientToken(ctx, token)
+}
+
+func (a *Auth) RevokeUserTokens(ctx context.Context, userID int64) error {
+	defer a.cache.tokens.Purge()
+
+	return a.AuthStorage.RevokeUserTokens(ctx, userID)
+}
+
+func (a *Auth) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	defer a.cache.tokens.Purge()
+
+	return a.AuthStorage.RevokeRefreshTokenFamily(ctx, familyID)
+}
+
+func (a *Auth) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	defer a.cache.tokens.Purge()
+
+	return a.AuthStorage.RevokeSession(ctx, userID, sessionID)
+}
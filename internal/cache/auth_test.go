@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"sso/internal/domain/storage/memory"
+	"testing"
+	"time"
+)
+
+func TestIsAuthenticatedExpiresCachedTokens(t *testing.T) {
+	storage, err := memory.Open("memory://?app=test:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := Limits{Size: 10, TTL: time.Hour}
+	a := NewAuth(storage, New(limits, limits, limits))
+	ctx := context.Background()
+
+	// The storage knows neither token, so only the cache can accept them.
+	for _, tt := range []struct {
+		name   string
+		expiry time.Time
+		want   bool
+	}{
+		{name: "valid", expiry: time.Now().Add(time.Minute), want: true},
+		{name: "expired", expiry: time.Now().Add(-time.Second), want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.name + " token"
+			a.cache.tokens.Add(sha256.Sum256([]byte(token)), cachedToken{userID: 1, expiry: tt.expiry})
+
+			ok, _, err := a.IsAuthenticated(ctx, token)
+			if err != nil {
+				t.Fatalf("IsAuthenticated: %v", err)
+			}
+			if ok != tt.want {
+				t.Errorf("IsAuthenticated = %t, want %t", ok, tt.want)
+			}
+		})
+	}
+}
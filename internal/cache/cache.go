@@ -0,0 +1,64 @@
+// Package cache keeps recently read apps, users and access tokens in memory
+// in front of the storage. The wrappers read through the cache and drop
+// entries when they change the rows behind them; changes made by other
+// processes are only seen once the entries expire.
+package cache
+
+import (
+	"crypto/sha256"
+	"sso/internal/domain/models"
+	"time"
+)
+
+// Limits bounds a cache to Size entries of at most TTL age. A cache with
+// size zero is disabled.
+type Limits struct {
+	Size int
+	TTL  time.Duration
+}
+
+// Cache holds the caches shared by Auth and Users, so that a change made
+// through one of them is not hidden by the other.
+type Cache struct {
+	apps *LRU[int, models.App]
+	// users holds users as AuthProvider returns them; profiles as
+	// UserProvider does.
+	users    *LRU[int64, models.User]
+	emails   *LRU[string, int64]
+	profiles *LRU[int64, models.User]
+	// tokens maps the hash of authenticated access tokens to their user.
+	tokens *LRU[[sha256.Size]byte, cachedToken]
+}
+
+// cachedToken is an authenticated access token. It is not authenticated
+// any more from its expiry on, however long the cache would keep it.
+type cachedToken struct {
+	userID int64
+	expiry time.Time
+}
+
+func New(apps Limits, users Limits, tokens Limits) *Cache {
+	return &Cache{
+		apps:     NewLRU[int, models.App](apps.Size, apps.TTL),
+		users:    NewLRU[int64, models.User](users.Size, users.TTL),
+		emails:   NewLRU[string, int64](users.Size, users.TTL),
+		profiles: NewLRU[int64, models.User](users.Size, users.TTL),
+		tokens:   NewLRU[[sha256.Size]byte, cachedToken](tokens.Size, tokens.TTL),
+	}
+}
+
+// Stats returns the lookup counters of every cache by name.
+func (c *Cache) Stats() map[string]Stats {
+	return map[string]Stats{
+		"apps":     c.apps.Stats(),
+		"users":    c.users.Stats(),
+		"emails":   c.emails.Stats(),
+		"profiles": c.profiles.Stats(),
+		"tokens":   c.tokens.Stats(),
+	}
+}
+
+func (c *Cache) invalidateUser(userID int64) {
+	c.users.Remove(userID)
+	c.profiles.Remove(userID)
+}
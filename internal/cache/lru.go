@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LRU is a fixed size cache that evicts the least recently used entry and
+// drops entries older than its TTL. A nil LRU caches nothing.
+type LRU[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	now   func() time.Time
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Stats counts the lookups of a cache. Expired entries count as misses.
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Len       int   `json:"len"`
+}
+
+// NewLRU returns nil when size is not positive, which disables the cache.
+func NewLRU[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	if size <= 0 {
+		return nil
+	}
+
+	return &LRU[K, V]{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[K]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expires) {
+		c.removeElement(el)
+		c.misses.Add(1)
+		return zero, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+
+	return e.value, true
+}
+
+func (c *LRU[K, V]) Add(key K, value V) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value = value
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *LRU[K, V]) Remove(key K) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Purge drops every entry.
+func (c *LRU[K, V]) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.items)
+}
+
+func (c *LRU[K, V]) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	n := c.ll.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Len:       n,
+	}
+}
+
+func (c *LRU[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
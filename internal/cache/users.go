@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"sso/internal/domain/models"
+	"sso/internal/services/user"
+)
+
+// Users caches the users of a user.UserProvider. Changes drop the user from
+// the caches of Auth as well.
+type Users struct {
+	user.UserProvider
+	cache *Cache
+}
+
+func NewUsers(provider user.UserProvider, cache *Cache) *Users {
+	return &Users{UserProvider: provider, cache: cache}
+}
+
+// GetUser returns a copy of the cached user, which the caller may modify.
+func (u *Users) GetUser(ctx context.Context, userID int64) (*models.User, error) {
+	if cached, ok := u.cache.profiles.Get(userID); ok {
+		return &cached, nil
+	}
+
+	found, err := u.UserProvider.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	u.cache.profiles.Add(userID, *found)
+
+	return found, nil
+}
+
+func (u *Users) UpdateUser(ctx context.Context, user models.User) error {
+	defer u.cache.invalidateUser(user.ID)
+
+	return u.UserProvider.UpdateUser(ctx, user)
+}
+
+// DeleteUser also drops all cached tokens, as the tokens of the user are
+// deleted with them.
+func (u *Users) DeleteUser(ctx context.Context, userID int64) error {
+	defer u.cache.tokens.Purge()
+	defer u.cache.invalidateUser(userID)
+
+	return u.UserProvider.DeleteUser(ctx, userID)
+}
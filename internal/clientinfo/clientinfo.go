@@ -0,0 +1,22 @@
+// Package clientinfo carries the address and user agent of the client that
+// makes a request.
+package clientinfo
+
+import "context"
+
+type Info struct {
+	IP        string
+	UserAgent string
+}
+
+type infoKey struct{}
+
+func With(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// FromContext returns the zero Info when the request carries none.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(infoKey{}).(Info)
+	return info
+}
@@ -8,16 +8,166 @@ import (
 )
 
 type Config struct {
-	Env            string     `yaml:"env" env-default:"local"`
+	Env string `yaml:"env" env-default:"local"`
+	// StoragePath is a Postgres connection string, or memory:// to keep
+	// everything in process memory; see memory.Open.
 	StoragePath    string     `yaml:"storage_path" env-required:"true"`
 	GRPC           GRPCConfig `yaml:"grpc"`
+	HTTP           HTTPConfig `yaml:"http"`
 	MigrationsPath string
 	TokenTTL       time.Duration `yaml:"token_ttl" env-default:"1h"`
+	RefreshTTL     time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// MaxSessionLifetime is how long a login can be kept alive by
+	// refreshing tokens before the user has to log in again. Zero means no
+	// limit.
+	MaxSessionLifetime time.Duration           `yaml:"max_session_lifetime"`
+	Signing            SigningConfig           `yaml:"signing"`
+	Activation         ActivationConfig        `yaml:"activation"`
+	PasswordReset      PasswordResetConfig     `yaml:"password_reset"`
+	Mail               MailConfig              `yaml:"mail"`
+	Secrets            SecretsConfig           `yaml:"secrets"`
+	OAuth              OAuthConfig             `yaml:"oauth"`
+	MFA                MFAConfig               `yaml:"mfa"`
+	WebAuthn           WebAuthnConfig          `yaml:"webauthn"`
+	Lockout            LockoutConfig           `yaml:"lockout"`
+	Password           PasswordConfig          `yaml:"password"`
+	TokenVerification  TokenVerificationConfig `yaml:"token_verification"`
+	Cache              CacheConfig             `yaml:"cache"`
 }
 
 type GRPCConfig struct {
+	Port      int             `yaml:"port"`
+	Timeout   time.Duration   `yaml:"timeout"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig limits gRPC calls per client. Methods maps full method
+// names such as /sso.Auth/Login to their limit; Default applies to all
+// other methods.
+type RateLimitConfig struct {
+	Default RateLimit            `yaml:"default"`
+	Methods map[string]RateLimit `yaml:"methods"`
+}
+
+// RateLimit allows Requests per Per, in bursts of up to Burst calls
+// (Requests when zero). Key is "peer", "user" or "app" and selects whose
+// calls are counted together; calls without an authenticated user or app
+// are counted by peer address. Calls are not limited when Requests is zero.
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+	Key      string        `yaml:"key"`
+}
+
+// HTTPConfig configures the HTTP server for well-known endpoints. The
+// server is disabled when Port is zero.
+type HTTPConfig struct {
 	Port    int           `yaml:"port"`
-	Timeout time.Duration `yaml:"timeout"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	// DebugVars serves the expvar variables, including the cache
+	// counters, at /debug/vars.
+	DebugVars bool `yaml:"debug_vars"`
+}
+
+// SigningConfig selects how access tokens are signed. HS256 uses the app
+// secret; RS256 and EdDSA use the private key at KeyPath, or an ephemeral
+// key generated at startup when KeyPath is empty.
+type SigningConfig struct {
+	Algorithm string `yaml:"algorithm" env-default:"HS256"`
+	KeyPath   string `yaml:"key_path"`
+}
+
+// ActivationConfig configures the activation tokens mailed on registration.
+// Users activate their account with POST /activate on the HTTP port, so
+// RequireForLogin needs the HTTP server.
+type ActivationConfig struct {
+	RequireForLogin bool          `yaml:"require_for_login" env-default:"false"`
+	TokenTTL        time.Duration `yaml:"token_ttl" env-default:"72h"`
+}
+
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"30m"`
+}
+
+// MailConfig selects the mail sender: "log" writes messages to the service
+// log, "file" stores them as .eml files in Dir.
+type MailConfig struct {
+	Sender string `yaml:"sender" env-default:"log"`
+	From   string `yaml:"from" env-default:"no-reply@sso.local"`
+	Dir    string `yaml:"dir" env-default:"./mail"`
+}
+
+// SecretsConfig holds the base64 encoded 32 byte key that encrypts secrets
+// stored in the database. App secrets are stored unencrypted when it is
+// empty, and TOTP two-factor authentication is disabled.
+type SecretsConfig struct {
+	EncryptionKey string `yaml:"encryption_key" env:"SSO_ENCRYPTION_KEY"`
+}
+
+// OAuthConfig configures the OAuth2 authorization server on the HTTP port.
+// Issuer is the public base URL of the server, used as the OpenID Connect
+// issuer and to build the endpoints advertised by discovery.
+type OAuthConfig struct {
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"1m"`
+	Issuer  string        `yaml:"issuer" env-default:"http://localhost:8082"`
+}
+
+// MFAConfig configures TOTP two-factor authentication, which also needs
+// Secrets.EncryptionKey. Issuer labels the account in authenticator apps.
+type MFAConfig struct {
+	Issuer       string        `yaml:"issuer" env-default:"sso"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// WebAuthnConfig describes the relying party for passkeys. Passkeys are
+// disabled when RPID is empty.
+type WebAuthnConfig struct {
+	RPID          string        `yaml:"rp_id"`
+	RPDisplayName string        `yaml:"rp_display_name" env-default:"SSO"`
+	RPOrigins     []string      `yaml:"rp_origins"`
+	SessionTTL    time.Duration `yaml:"session_ttl" env-default:"5m"`
+}
+
+// LockoutConfig throttles password guessing. After each failed login the
+// account has to wait BaseDelay, doubled per further failure up to
+// MaxDelay; after MaxFailures it is locked for LockDuration. An address with
+// IPMaxFailures failures across all accounts is blocked as well. Failures
+// older than Window are forgotten. Lockout is disabled when MaxFailures is
+// zero.
+type LockoutConfig struct {
+	MaxFailures   int           `yaml:"max_failures" env-default:"5"`
+	LockDuration  time.Duration `yaml:"lock_duration" env-default:"15m"`
+	BaseDelay     time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay      time.Duration `yaml:"max_delay" env-default:"1m"`
+	Window        time.Duration `yaml:"window" env-default:"1h"`
+	IPMaxFailures int           `yaml:"ip_max_failures" env-default:"100"`
+}
+
+// PasswordConfig is the policy new passwords are checked against and how
+// they are hashed. MaxLength is in bytes; with bcrypt it cannot exceed the
+// 72 bytes bcrypt hashes. Passwords are also looked up in the breached
+// password list when BreachedListDir is set; see password.RangeDir for its
+// layout.
+type PasswordConfig struct {
+	MinLength            int                `yaml:"min_length" env-default:"8"`
+	MaxLength            int                `yaml:"max_length" env-default:"72"`
+	MinCharClasses       int                `yaml:"min_char_classes" env-default:"2"`
+	DisallowPersonalInfo bool               `yaml:"disallow_personal_info" env-default:"true"`
+	BreachedListDir      string             `yaml:"breached_list_dir"`
+	Hash                 PasswordHashConfig `yaml:"hash"`
+}
+
+// PasswordHashConfig selects the algorithm new password hashes use:
+// "bcrypt" or "argon2id". Existing hashes of the other algorithm or with
+// weaker parameters are replaced when their users log in. Argon2Memory is
+// in KiB.
+type PasswordHashConfig struct {
+	Algorithm     string `yaml:"algorithm" env-default:"bcrypt"`
+	BcryptCost    int    `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2Time    uint32 `yaml:"argon2_time" env-default:"3"`
+	Argon2Memory  uint32 `yaml:"argon2_memory" env-default:"65536"`
+	Argon2Threads uint8  `yaml:"argon2_threads" env-default:"4"`
 }
 
 func MustLoad() *Config {
@@ -54,3 +204,31 @@ func fetchConfigPath() string {
 
 	return res
 }
+
+// TokenVerificationConfig selects how access tokens are checked: "stateful"
+// looks every token up in the database, "stateless" only verifies its
+// signature and expiry, and "hybrid" additionally checks a list of revoked
+// tokens. App keys and the revocation list are reloaded every
+// RefreshInterval, which bounds how long a revoked token keeps working on
+// other instances in hybrid mode.
+type TokenVerificationConfig struct {
+	Mode            string        `yaml:"mode" env-default:"stateful"`
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"30s"`
+}
+
+// CacheConfig sizes the in-process caches in front of the database. A
+// cache with size zero is disabled. Entries changed through this process
+// are dropped right away; changes made elsewhere, such as with cmd/apps, and
+// tokens revoked by other instances are only noticed after TTL. Keep the
+// app and token TTLs short when running more than one instance, or disable
+// the token cache where revocations must take effect at once.
+type CacheConfig struct {
+	Apps   CacheLimits `yaml:"apps"`
+	Users  CacheLimits `yaml:"users"`
+	Tokens CacheLimits `yaml:"tokens"`
+}
+
+type CacheLimits struct {
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl" env-default:"1m"`
+}
@@ -1,11 +1,15 @@
 package models
 
+import "time"
+
 type User struct {
 	ID           int64
 	Fname        string
 	Lname        string
 	Email        string
-	Role         string
+	Roles        []string
+	Permissions  []string
+	AppRoles     []string
 	Activated    bool
 	PasswordHash Password
 }
@@ -21,8 +25,162 @@ type Password struct {
 	Hash      []byte
 }
 
+// PasswordHasher hashes passwords into an encoded form that records the
+// algorithm and its parameters, so hashes made with earlier settings keep
+// verifying. Verify reports with rehash that the hash uses another
+// algorithm or weaker parameters than the hasher's and should be replaced.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(password string, encoded []byte) (match bool, rehash bool, err error)
+}
+
+// Set replaces the password with plaintext.
+func (p *Password) Set(plaintext string, hasher PasswordHasher) error {
+	hash, err := hasher.Hash(plaintext)
+	if err != nil {
+		return err
+	}
+
+	p.PlainText = &plaintext
+	p.Hash = hash
+
+	return nil
+}
+
+// Matches reports whether plaintext is the password, and whether its hash
+// should be replaced by calling Set with the same plaintext.
+func (p *Password) Matches(plaintext string, hasher PasswordHasher) (match bool, rehash bool, err error) {
+	return hasher.Verify(plaintext, p.Hash)
+}
+
+const (
+	ClientTypeConfidential = "confidential"
+	ClientTypePublic       = "public"
+)
+
+// App is a client application users log in to. Users of apps with
+// OpenMembership become members on their first login; other apps only
+// admit users that were added as members. Public clients cannot keep a
+// secret and must use PKCE in the OAuth2 flow.
 type App struct {
-	ID     int
-	Name   string
-	Secret string
+	ID             int
+	Name           string
+	Secret         string
+	OpenMembership bool
+	RedirectURIs   []string
+	ClientType     string
+	// ClientScopes are the scopes the app may request for itself with the
+	// client credentials grant.
+	ClientScopes []string
+	// AccessTokenTTL and RefreshTokenTTL override the server-wide token
+	// lifetimes when set.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type RefreshToken struct {
+	UserID   int64
+	AppID    int
+	FamilyID string
+	Expiry   time.Time
+	Used     bool
+	Revoked  bool
+}
+
+// Session is a login of a user to an app on some device. Its ID is the
+// refresh token family of the login, so it lasts as long as the family is
+// refreshed and ends when the family is revoked.
+type Session struct {
+	ID         string
+	UserID     int64
+	AppID      int
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Expiry     time.Time
+	// Scope is the OAuth2 scope the session was granted; empty for logins
+	// outside of the authorization code flow.
+	Scope string
+}
+
+// ClientToken is an access token issued to an app itself through the client
+// credentials grant. It has no user subject.
+type ClientToken struct {
+	AppID  int
+	Scope  string
+	Expiry time.Time
+}
+
+// TOTP is the time-based one-time password enrollment of a user. Secret is
+// stored sealed; LastCounter is the period of the last accepted code.
+type TOTP struct {
+	UserID      int64
+	Secret      string
+	Confirmed   bool
+	LastCounter uint64
+}
+
+// WebAuthnCredential is a passkey registered by a user.
+type WebAuthnCredential struct {
+	ID              []byte
+	UserID          int64
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+}
+
+// WebAuthnSession holds the state of a registration or login ceremony
+// between its begin and finish steps. UserID is zero for discoverable
+// logins, where the user is known only from the assertion.
+type WebAuthnSession struct {
+	UserID int64
+	Kind   string
+	Data   []byte
+	Expiry time.Time
+}
+
+// LoginAttempts counts the recent failed logins for an account or a client
+// address. Further attempts are refused until BlockedUntil.
+type LoginAttempts struct {
+	Failures     int
+	BlockedUntil time.Time
+}
+
+// TokenPair is the result of a login. When the user has two-factor
+// authentication enabled, only MFAToken is set: it is exchanged for the
+// other tokens together with a one-time code.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	MFAToken     string
+	ExpiresIn    time.Duration
+}
+
+// SigningKey is a key from an app's key ring. PrivateKey holds a PEM encoded
+// private key for asymmetric algorithms and the raw secret for HS256.
+type SigningKey struct {
+	ID         string
+	AppID      int
+	Algorithm  string
+	PrivateKey []byte
+	Active     bool
+	CreatedAt  time.Time
+	RetireAt   *time.Time
+}
+
+type AuthorizationCode struct {
+	AppID               int
+	UserID              int64
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	Expiry              time.Time
 }
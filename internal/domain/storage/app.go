@@ -5,28 +5,170 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"sso/internal/domain/models"
+	"time"
 )
 
+// appColumns are the columns scanApp reads. Token lifetimes are stored in
+// seconds; NULL means the server default.
+const appColumns = `id, name, secret, open_membership, redirect_uris, client_type, client_scopes,
+	COALESCE(access_token_ttl_seconds, 0), COALESCE(refresh_token_ttl_seconds, 0)`
+
 func (s *AuthStorage) App(ctx context.Context, id int) (models.App, error) {
 	const op = "storage.App"
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps WHERE id = $1")
+	row := s.db.QueryRowContext(ctx, "SELECT "+appColumns+" FROM apps WHERE id = $1", id)
+
+	app, err := scanApp(row)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+
 		return models.App{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, id)
+	return app, nil
+}
+
+func (s *AuthStorage) SaveApp(ctx context.Context, app models.App) (int, error) {
+	const op = "storage.SaveApp"
+
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO apps(name, secret, open_membership, redirect_uris, client_type, client_scopes, access_token_ttl_seconds, refresh_token_ttl_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, 0))
+		RETURNING id`,
+		app.Name, app.Secret, app.OpenMembership, pq.Array(app.RedirectURIs), app.ClientType, pq.Array(app.ClientScopes),
+		seconds(app.AccessTokenTTL), seconds(app.RefreshTokenTTL),
+	)
+
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *AuthStorage) Apps(ctx context.Context) ([]models.App, error) {
+	const op = "storage.Apps"
 
-	var app models.App
-	err = row.Scan(&app.ID, &app.Name, &app.Secret)
+	rows, err := s.db.QueryContext(ctx, "SELECT "+appColumns+" FROM apps ORDER BY id")
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
+		apps = append(apps, app)
+	}
 
-		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateApp updates everything but the secret, which only changes through
+// UpdateAppSecret.
+func (s *AuthStorage) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "storage.UpdateApp"
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE apps SET name = $1, open_membership = $2, redirect_uris = $3, client_type = $4, client_scopes = $5,
+			access_token_ttl_seconds = NULLIF($6, 0), refresh_token_ttl_seconds = NULLIF($7, 0)
+		WHERE id = $8`,
+		app.Name, app.OpenMembership, pq.Array(app.RedirectURIs), app.ClientType, pq.Array(app.ClientScopes),
+		seconds(app.AccessTokenTTL), seconds(app.RefreshTokenTTL), app.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, result)
+}
+
+func (s *AuthStorage) UpdateAppSecret(ctx context.Context, appID int, secret string) error {
+	const op = "storage.UpdateAppSecret"
+
+	result, err := s.db.ExecContext(ctx, `UPDATE apps SET secret = $1 WHERE id = $2`, secret, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, result)
+}
+
+func (s *AuthStorage) DeleteApp(ctx context.Context, appID int) error {
+	const op = "storage.DeleteApp"
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM apps WHERE id = $1`, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, result)
+}
+
+func appAffected(op string, result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrAppNotFound)
 	}
 
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func scanApp(row interface{ Scan(dest ...any) error }) (models.App, error) {
+	var (
+		app                   models.App
+		accessTTL, refreshTTL int64
+	)
+
+	err := row.Scan(
+		&app.ID,
+		&app.Name,
+		&app.Secret,
+		&app.OpenMembership,
+		pq.Array(&app.RedirectURIs),
+		&app.ClientType,
+		pq.Array(&app.ClientScopes),
+		&accessTTL,
+		&refreshTTL,
+	)
+	if err != nil {
+		return models.App{}, err
+	}
+
+	app.AccessTokenTTL = time.Duration(accessTTL) * time.Second
+	app.RefreshTokenTTL = time.Duration(refreshTTL) * time.Second
+
 	return app, nil
 }
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
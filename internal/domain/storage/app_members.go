@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *AuthStorage) IsAppMember(ctx context.Context, appID int, userID int64) (bool, error) {
+	const op = "storage.IsAppMember"
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM app_members WHERE app_id = $1 AND user_id = $2)`,
+		appID, userID,
+	)
+
+	var isMember bool
+	if err := row.Scan(&isMember); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return isMember, nil
+}
+
+func (s *AuthStorage) AddAppMember(ctx context.Context, appID int, userID int64) error {
+	const op = "storage.AddAppMember"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO app_members(app_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		appID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RemoveAppMember removes the membership together with the app roles of the
+// user, revokes the access and refresh tokens issued for the app and ends
+// the sessions in it.
+func (s *AuthStorage) RemoveAppMember(ctx context.Context, appID int, userID int64) error {
+	const op = "storage.RemoveAppMember"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM app_members WHERE app_id = $1 AND user_id = $2`, appID, userID); err != nil {
+		return fail(err)
+	}
+
+	// Access tokens carry no app, they belong to it through the session or
+	// refresh token family they were issued in.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tokens SET revoked = true
+		WHERE user_id = $2 AND family_id IN (
+			SELECT id FROM sessions WHERE app_id = $1 AND user_id = $2
+			UNION
+			SELECT family_id FROM refresh_tokens WHERE app_id = $1 AND user_id = $2
+		)`,
+		appID, userID,
+	)
+	if err != nil {
+		return fail(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked = true
+		WHERE app_id = $1 AND user_id = $2`,
+		appID, userID,
+	)
+	if err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE app_id = $1 AND user_id = $2`, appID, userID); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) AppRoles(ctx context.Context, appID int, userID int64) ([]string, error) {
+	const op = "storage.AppRoles"
+
+	roles, err := s.names(ctx, `
+		SELECT r.name FROM roles r
+		INNER JOIN app_user_roles aur ON aur.role_id = r.id
+		WHERE aur.app_id = $1 AND aur.user_id = $2
+		ORDER BY r.name`,
+		appID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// AssignAppRole grants the role within the app. The user must already be a
+// member of the app.
+func (s *AuthStorage) AssignAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	const op = "storage.AssignAppRole"
+
+	isMember, err := s.IsAppMember(ctx, appID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !isMember {
+		return fmt.Errorf("%s: %w", op, ErrNotAppMember)
+	}
+
+	roleID, err := s.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO app_user_roles(app_id, user_id, role_id) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		appID, userID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) RevokeAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	const op = "storage.RevokeAppRole"
+
+	roleID, err := s.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM app_user_roles
+		WHERE app_id = $1 AND user_id = $2 AND role_id = $3`,
+		appID, userID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
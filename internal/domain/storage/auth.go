@@ -25,13 +25,18 @@ func (s *AuthStorage) SaveUser(ctx context.Context, fname string, lname string,
 		return 0, fail(err)
 	}
 
-	stmt, err := s.db.Prepare("INSERT INTO users(fname,lname, email, password_hash,user_role,activated) VALUES($1, $2, $3, $4, $5,$6) RETURNING id")
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO users(fname,lname, email, password_hash,activated) VALUES($1, $2, $3, $4, $5) RETURNING id")
 	if err != nil {
 		return 0, fail(err)
 	}
 
 	var id int64
-	err = stmt.QueryRowContext(ctx, fname, lname, email, passHash, "user", false).Scan(&id)
+	err = stmt.QueryRowContext(ctx, fname, lname, email, passHash, false).Scan(&id)
+	if err != nil {
+		return 0, fail(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_roles(user_id, role_id) SELECT $1, id FROM roles WHERE name = $2`, id, "user")
 	if err != nil {
 		return 0, fail(err)
 	}
@@ -67,27 +72,90 @@ func (s *AuthStorage) GetUserByEmail(ctx context.Context, email string) (models.
 	return user, nil
 }
 
-func (s *AuthStorage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
-	const op = "storage.sqlite.IsAdmin"
-	stmt, err := s.db.Prepare("SELECT user_role FROM users WHERE id = $1")
+func (s *AuthStorage) GetUserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.UserByID"
+
+	stmt, err := s.db.Prepare("SELECT id, fname,lname, email, password_hash, activated FROM users WHERE id = $1")
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return false, fmt.Errorf("%s: %w", op, ErrUserNotFound)
-		default:
-			return false, fmt.Errorf("%s: %w", op, err)
-		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	row := stmt.QueryRowContext(ctx, userID)
 
-	var role string
-	err = row.Scan(&role)
+	var user models.User
+	err = row.Scan(&user.ID, &user.Fname, &user.Lname, &user.Email, &user.PasswordHash.Hash, &user.Activated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *AuthStorage) ActivateUser(ctx context.Context, userID int64) error {
+	const op = "storage.ActivateUser"
+
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET activated = true WHERE id = $1`, userID)
 	if err != nil {
-		println(fmt.Errorf("%s: %w", op, ErrUserNotFound))
-		return false, err
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) UpdatePassword(ctx context.Context, userID int64, passHash []byte) error {
+	const op = "storage.UpdatePassword"
+
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (s *AuthStorage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	const op = "storage.IsAdmin"
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_roles ur
+			INNER JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = u.id AND r.name = $2
+		)
+		FROM users u
+		WHERE u.id = $1`,
+		userID, "admin",
+	)
+
+	var isAdmin bool
+	if err := row.Scan(&isAdmin); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	isRoleAdmin := role == "admin"
-	return isRoleAdmin, nil
+	return isAdmin, nil
 }
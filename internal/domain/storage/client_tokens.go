@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+func (s *AuthStorage) SaveClientToken(ctx context.Context, tokenPlainText string, token models.ClientToken) error {
+	const op = "storage.SaveClientToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO client_tokens(hash, app_id, scope, expiry)
+		VALUES ($1, $2, $3, $4)`,
+		tokenHash[:], token.AppID, token.Scope, token.Expiry,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ClientToken returns the unexpired, unrevoked client token.
+func (s *AuthStorage) ClientToken(ctx context.Context, tokenPlainText string) (models.ClientToken, error) {
+	const op = "storage.ClientToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT app_id, scope, expiry
+		FROM client_tokens
+		WHERE hash = $1 AND expiry > $2 AND NOT revoked`,
+		tokenHash[:], time.Now(),
+	)
+
+	var token models.ClientToken
+	if err := row.Scan(&token.AppID, &token.Scope, &token.Expiry); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ClientToken{}, fmt.Errorf("%s: %w", op, ErrTokenNotFound)
+		}
+
+		return models.ClientToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+func (s *AuthStorage) RevokeClientToken(ctx context.Context, tokenPlainText string) error {
+	const op = "storage.RevokeClientToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	result, err := s.db.ExecContext(ctx, `UPDATE client_tokens SET revoked = true WHERE hash = $1`, tokenHash[:])
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrTokenNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+func (s *AuthStorage) LoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	const op = "storage.LoginAttempts"
+
+	row := s.db.QueryRowContext(ctx, `SELECT failures, blocked_until FROM login_attempts WHERE key = $1`, key)
+
+	var (
+		attempts     models.LoginAttempts
+		blockedUntil sql.NullTime
+	)
+	if err := row.Scan(&attempts.Failures, &blockedUntil); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LoginAttempts{}, nil
+		}
+
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+	attempts.BlockedUntil = blockedUntil.Time
+
+	return attempts, nil
+}
+
+// RecordLoginFailure increments the failure counter of key in one
+// statement, so concurrent attempts cannot lose updates.
+func (s *AuthStorage) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	const op = "storage.RecordLoginFailure"
+
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts(key, failures, last_failure)
+		VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure < now() - make_interval(secs => $2) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure = now()
+		RETURNING failures`,
+		key, window.Seconds(),
+	)
+
+	var failures int
+	if err := row.Scan(&failures); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures, nil
+}
+
+func (s *AuthStorage) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	const op = "storage.BlockLogin"
+
+	_, err := s.db.ExecContext(ctx, `UPDATE login_attempts SET blocked_until = $1 WHERE key = $2`, until, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) ResetLoginAttempts(ctx context.Context, key string) error {
+	const op = "storage.ResetLoginAttempts"
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
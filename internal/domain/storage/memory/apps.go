@@ -0,0 +1,278 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"time"
+)
+
+func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
+	const op = "memory.App"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[id]
+	if !ok {
+		return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+
+	return copyApp(app), nil
+}
+
+func (s *Storage) SaveApp(ctx context.Context, app models.App) (int, error) {
+	const op = "memory.SaveApp"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.apps {
+		if other.Name == app.Name || other.Secret == app.Secret {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+	}
+
+	s.nextAppID++
+	app.ID = s.nextAppID
+	stored := copyApp(&app)
+	s.apps[app.ID] = &stored
+
+	return app.ID, nil
+}
+
+func (s *Storage) Apps(ctx context.Context) ([]models.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var apps []models.App
+	for _, app := range s.apps {
+		apps = append(apps, copyApp(app))
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
+
+	return apps, nil
+}
+
+// UpdateApp updates everything but the secret, which only changes through
+// UpdateAppSecret.
+func (s *Storage) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "memory.UpdateApp"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.apps[app.ID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	for _, other := range s.apps {
+		if other.ID != app.ID && other.Name == app.Name {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+	}
+
+	app.Secret = stored.Secret
+	*stored = copyApp(&app)
+
+	return nil
+}
+
+func (s *Storage) UpdateAppSecret(ctx context.Context, appID int, secret string) error {
+	const op = "memory.UpdateAppSecret"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	app.Secret = secret
+
+	return nil
+}
+
+// DeleteApp deletes the app together with everything issued for it.
+func (s *Storage) DeleteApp(ctx context.Context, appID int) error {
+	const op = "memory.DeleteApp"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+
+	delete(s.apps, appID)
+
+	for m := range s.members {
+		if m.appID == appID {
+			s.deleteMembership(m)
+		}
+	}
+	for m := range s.consents {
+		if m.appID == appID {
+			delete(s.consents, m)
+		}
+	}
+	for h, t := range s.refreshTokens {
+		if t.AppID == appID {
+			delete(s.refreshTokens, h)
+		}
+	}
+	for h, t := range s.clientTokens {
+		if t.appID == appID {
+			delete(s.clientTokens, h)
+		}
+	}
+	for id, session := range s.sessions {
+		if session.AppID == appID {
+			delete(s.sessions, id)
+		}
+	}
+	for h, code := range s.codes {
+		if code.AppID == appID {
+			delete(s.codes, h)
+		}
+	}
+
+	keys := s.signingKeys[:0]
+	for _, key := range s.signingKeys {
+		if key.AppID != appID {
+			keys = append(keys, key)
+		}
+	}
+	s.signingKeys = keys
+
+	return nil
+}
+
+// AppSigningKeys returns the keys of the app that have not been retired yet,
+// newest first.
+func (s *Storage) AppSigningKeys(ctx context.Context, appID int) ([]models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var keys []models.SigningKey
+	for i := len(s.signingKeys) - 1; i >= 0; i-- {
+		key := s.signingKeys[i]
+		if key.AppID == appID && (key.RetireAt == nil || key.RetireAt.After(now)) {
+			keys = append(keys, copySigningKey(key))
+		}
+	}
+
+	return keys, nil
+}
+
+// SigningKeys returns the keys of every app that have not been retired yet.
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var keys []models.SigningKey
+	for i := len(s.signingKeys) - 1; i >= 0; i-- {
+		key := s.signingKeys[i]
+		if key.RetireAt == nil || key.RetireAt.After(now) {
+			keys = append(keys, copySigningKey(key))
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].AppID < keys[j].AppID })
+
+	return keys, nil
+}
+
+// RotateSigningKey makes key the active key of its app. The previously
+// active key keeps verifying tokens until retireAt.
+func (s *Storage) RotateSigningKey(ctx context.Context, key models.SigningKey, retireAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.signingKeys {
+		if other.AppID == key.AppID && other.Active {
+			other.Active = false
+			other.RetireAt = &retireAt
+		}
+	}
+
+	key.Active = true
+	key.CreatedAt = time.Now()
+	key.RetireAt = nil
+	stored := copySigningKey(&key)
+	s.signingKeys = append(s.signingKeys, &stored)
+
+	return nil
+}
+
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, codePlainText string, code models.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[hashOf(codePlainText)] = &code
+
+	return nil
+}
+
+// ConsumeAuthorizationCode deletes the unexpired code and returns it, so a
+// code can be exchanged only once.
+func (s *Storage) ConsumeAuthorizationCode(ctx context.Context, codePlainText string) (models.AuthorizationCode, error) {
+	const op = "memory.ConsumeAuthorizationCode"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := hashOf(codePlainText)
+	code, ok := s.codes[h]
+	if !ok || !code.Expiry.After(time.Now()) {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	delete(s.codes, h)
+
+	return *code, nil
+}
+
+// ConsentScope returns the scope the user consented to for the app. It
+// reports false when the user has not consented yet.
+func (s *Storage) ConsentScope(ctx context.Context, userID int64, appID int) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scope, ok := s.consents[membership{appID: appID, userID: userID}]
+
+	return scope, ok, nil
+}
+
+func (s *Storage) SaveConsent(ctx context.Context, userID int64, appID int, scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.consents[membership{appID: appID, userID: userID}] = scope
+
+	return nil
+}
+
+func copyApp(app *models.App) models.App {
+	found := *app
+	found.RedirectURIs = slices.Clone(app.RedirectURIs)
+	found.ClientScopes = slices.Clone(app.ClientScopes)
+
+	return found
+}
+
+func copySigningKey(key *models.SigningKey) models.SigningKey {
+	found := *key
+	found.PrivateKey = slices.Clone(key.PrivateKey)
+	if key.RetireAt != nil {
+		retireAt := *key.RetireAt
+		found.RetireAt = &retireAt
+	}
+
+	return found
+}
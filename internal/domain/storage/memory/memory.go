@@ -0,0 +1,187 @@
+// Package memory implements the storage of the services in process memory.
+// It needs no database, which makes it suitable for tests and local
+// development; everything is lost when the process exits.
+//
+// The store mirrors the Postgres storage, including its errors and the
+// rows removed when a user or an app is deleted.
+package memory
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sso/internal/domain/models"
+	"sso/internal/lockout"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheme selects the memory store in storage_path.
+const Scheme = "memory"
+
+// lastSeenResolution limits how often a session's last-seen time is
+// updated, like in the Postgres storage.
+const lastSeenResolution = time.Minute
+
+// cleanupInterval is how often CheckTokens drops expired rows.
+const cleanupInterval = 20 * time.Minute
+
+// rolePermissions are the roles and their permissions the migrations seed.
+var rolePermissions = map[string][]string{
+	"user":  nil,
+	"admin": {"apps:manage", "roles:manage", "tokens:revoke", "users:delete", "users:read", "users:write"},
+}
+
+type hash = [sha256.Size]byte
+
+type membership struct {
+	appID  int
+	userID int64
+}
+
+type token struct {
+	userID   int64
+	expiry   time.Time
+	familyID string
+	scope    string
+	revoked  bool
+}
+
+type clientToken struct {
+	appID   int
+	scope   string
+	expiry  time.Time
+	revoked bool
+}
+
+type recoveryCode struct {
+	userID int64
+	used   bool
+}
+
+// Storage implements the auth, user and app storage. A single lock guards
+// all data, so every method is atomic like a database transaction.
+type Storage struct {
+	mu sync.Mutex
+
+	users      map[int64]*models.User
+	nextUserID int64
+	userRoles  map[int64]map[string]bool
+
+	apps      map[int]*models.App
+	nextAppID int
+	members   map[membership]bool
+	appRoles  map[membership]map[string]bool
+	consents  map[membership]string
+
+	tokens        map[hash]*token
+	refreshTokens map[hash]*models.RefreshToken
+	clientTokens  map[hash]*clientToken
+	sessions      map[string]*models.Session
+	codes         map[hash]*models.AuthorizationCode
+	signingKeys   []*models.SigningKey
+
+	totps               map[int64]*models.TOTP
+	recoveryCodes       map[hash]*recoveryCode
+	webAuthnCredentials []*models.WebAuthnCredential
+	webAuthnSessions    map[hash]*models.WebAuthnSession
+
+	loginAttempts *lockout.MemoryStore
+}
+
+func New() *Storage {
+	return &Storage{
+		users:            make(map[int64]*models.User),
+		userRoles:        make(map[int64]map[string]bool),
+		apps:             make(map[int]*models.App),
+		members:          make(map[membership]bool),
+		appRoles:         make(map[membership]map[string]bool),
+		consents:         make(map[membership]string),
+		tokens:           make(map[hash]*token),
+		refreshTokens:    make(map[hash]*models.RefreshToken),
+		clientTokens:     make(map[hash]*clientToken),
+		sessions:         make(map[string]*models.Session),
+		codes:            make(map[hash]*models.AuthorizationCode),
+		totps:            make(map[int64]*models.TOTP),
+		recoveryCodes:    make(map[hash]*recoveryCode),
+		webAuthnSessions: make(map[hash]*models.WebAuthnSession),
+		loginAttempts:    lockout.NewMemoryStore(),
+	}
+}
+
+// Open returns a new store for a storage path such as memory://. Apps to
+// create at startup are given as app=name:secret query parameters, e.g.
+// memory://?app=web:secret, and get ids in the order they are listed.
+func Open(storagePath string) (*Storage, error) {
+	const op = "memory.Open"
+
+	u, err := url.Parse(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if u.Scheme != Scheme {
+		return nil, fmt.Errorf("%s: unsupported scheme %q", op, u.Scheme)
+	}
+
+	s := New()
+
+	for _, app := range u.Query()["app"] {
+		name, secret, ok := strings.Cut(app, ":")
+		if !ok || name == "" || secret == "" {
+			return nil, fmt.Errorf("%s: app %q is not name:secret", op, app)
+		}
+
+		s.nextAppID++
+		s.apps[s.nextAppID] = &models.App{
+			ID:             s.nextAppID,
+			Name:           name,
+			Secret:         secret,
+			OpenMembership: true,
+			ClientType:     models.ClientTypeConfidential,
+		}
+	}
+
+	return s, nil
+}
+
+// CheckTokens drops expired tokens, sessions and stale login attempts
+// periodically. It never returns.
+func (s *Storage) CheckTokens() {
+	for {
+		s.deleteExpired(time.Now())
+
+		time.Sleep(cleanupInterval)
+	}
+}
+
+func (s *Storage) deleteExpired(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for h, t := range s.tokens {
+		if t.expiry.Before(now) {
+			delete(s.tokens, h)
+		}
+	}
+	for h, t := range s.clientTokens {
+		if t.expiry.Before(now) {
+			delete(s.clientTokens, h)
+		}
+	}
+	for h, ws := range s.webAuthnSessions {
+		if ws.Expiry.Before(now) {
+			delete(s.webAuthnSessions, h)
+		}
+	}
+	for id, session := range s.sessions {
+		if session.Expiry.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+	s.loginAttempts.DeleteStale(now, 24*time.Hour)
+}
+
+func hashOf(plaintext string) hash {
+	return sha256.Sum256([]byte(plaintext))
+}
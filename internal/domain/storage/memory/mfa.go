@@ -0,0 +1,213 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"time"
+)
+
+// SaveTOTP starts a new, unconfirmed enrollment of the user, replacing any
+// previous one.
+func (s *Storage) SaveTOTP(ctx context.Context, userID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totps[userID] = &models.TOTP{UserID: userID, Secret: secret}
+
+	return nil
+}
+
+func (s *Storage) TOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	const op = "memory.TOTP"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok {
+		return models.TOTP{}, fmt.Errorf("%s: %w", op, storage.ErrTOTPNotFound)
+	}
+
+	return *totp, nil
+}
+
+// ConfirmTOTP enables the enrollment and replaces the recovery codes of the
+// user with the given ones.
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID int64, counter uint64, recoveryCodes []string) error {
+	const op = "memory.ConfirmTOTP"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPNotFound)
+	}
+	totp.Confirmed = true
+	totp.LastCounter = counter
+
+	s.deleteRecoveryCodes(userID)
+	for _, code := range recoveryCodes {
+		s.recoveryCodes[hashOf(code)] = &recoveryCode{userID: userID}
+	}
+
+	return nil
+}
+
+// UseTOTPCounter records counter as the last accepted period. It reports
+// false when a code of the same or a later period was accepted before.
+func (s *Storage) UseTOTPCounter(ctx context.Context, userID int64, counter uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok || !totp.Confirmed || totp.LastCounter >= counter {
+		return false, nil
+	}
+	totp.LastCounter = counter
+
+	return true, nil
+}
+
+// UseRecoveryCode marks the recovery code as used. It reports false when
+// the code does not belong to the user or was used before.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc, ok := s.recoveryCodes[hashOf(code)]
+	if !ok || rc.userID != userID || rc.used {
+		return false, nil
+	}
+	rc.used = true
+
+	return true, nil
+}
+
+// DeleteTOTP disables two-factor authentication for the user.
+func (s *Storage) DeleteTOTP(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteRecoveryCodes(userID)
+	delete(s.totps, userID)
+
+	return nil
+}
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	const op = "memory.SaveWebAuthnCredential"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.webAuthnCredentials {
+		if bytes.Equal(other.ID, credential.ID) {
+			return fmt.Errorf("%s: %w", op, storage.ErrCredentialExists)
+		}
+	}
+
+	stored := copyCredential(&credential)
+	s.webAuthnCredentials = append(s.webAuthnCredentials, &stored)
+
+	return nil
+}
+
+// WebAuthnCredentials returns the credentials of the user in the order they
+// were registered.
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var credentials []models.WebAuthnCredential
+	for _, credential := range s.webAuthnCredentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, copyCredential(credential))
+		}
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnCredential records a successful login with the credential.
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.webAuthnCredentials {
+		if bytes.Equal(stored.ID, credential.ID) {
+			stored.SignCount = credential.SignCount
+			stored.BackupState = credential.BackupState
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, id string, session models.WebAuthnSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.Data = slices.Clone(session.Data)
+	s.webAuthnSessions[hashOf(id)] = &session
+
+	return nil
+}
+
+// ConsumeWebAuthnSession deletes and returns the unexpired session, so every
+// ceremony can be finished only once.
+func (s *Storage) ConsumeWebAuthnSession(ctx context.Context, id string, kind string) (models.WebAuthnSession, error) {
+	const op = "memory.ConsumeWebAuthnSession"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := hashOf(id)
+	session, ok := s.webAuthnSessions[h]
+	if !ok || session.Kind != kind || !session.Expiry.After(time.Now()) {
+		return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	delete(s.webAuthnSessions, h)
+
+	return *session, nil
+}
+
+// LoginAttempts and the other login attempt methods use a
+// lockout.MemoryStore, which has a lock of its own.
+func (s *Storage) LoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	return s.loginAttempts.LoginAttempts(ctx, key)
+}
+
+func (s *Storage) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	return s.loginAttempts.RecordLoginFailure(ctx, key, window)
+}
+
+func (s *Storage) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	return s.loginAttempts.BlockLogin(ctx, key, until)
+}
+
+func (s *Storage) ResetLoginAttempts(ctx context.Context, key string) error {
+	return s.loginAttempts.ResetLoginAttempts(ctx, key)
+}
+
+func (s *Storage) deleteRecoveryCodes(userID int64) {
+	for h, code := range s.recoveryCodes {
+		if code.userID == userID {
+			delete(s.recoveryCodes, h)
+		}
+	}
+}
+
+func copyCredential(credential *models.WebAuthnCredential) models.WebAuthnCredential {
+	found := *credential
+	found.ID = slices.Clone(credential.ID)
+	found.PublicKey = slices.Clone(credential.PublicKey)
+	found.Transports = slices.Clone(credential.Transports)
+	found.AAGUID = slices.Clone(credential.AAGUID)
+
+	return found
+}
@@ -0,0 +1,381 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"time"
+)
+
+// SaveToken stores an access token. It reports false when the token is
+// already stored.
+func (s *Storage) SaveToken(ctx context.Context, tokenPlainText string, userID int64, familyID string, expiry time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := hashOf(tokenPlainText)
+	if _, ok := s.tokens[h]; ok {
+		return false, nil
+	}
+
+	s.tokens[h] = &token{
+		userID:   userID,
+		expiry:   expiry,
+		familyID: familyID,
+		scope:    storage.ScopeAuthentication,
+	}
+
+	return true, nil
+}
+
+func (s *Storage) IsAuthenticated(ctx context.Context, tokenPlainText string) (bool, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[hashOf(tokenPlainText)]
+	if !ok || t.scope != storage.ScopeAuthentication || t.revoked || !t.expiry.After(time.Now()) {
+		return false, 0, nil
+	}
+	if _, ok := s.users[t.userID]; !ok {
+		return false, 0, nil
+	}
+
+	return true, t.userID, nil
+}
+
+// SaveScopedToken stores a single-use token such as an activation token.
+func (s *Storage) SaveScopedToken(ctx context.Context, tokenPlainText string, userID int64, scope string, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[hashOf(tokenPlainText)] = &token{userID: userID, expiry: expiry, scope: scope}
+
+	return nil
+}
+
+func (s *Storage) DeleteScopedTokens(ctx context.Context, userID int64, scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for h, t := range s.tokens {
+		if t.userID == userID && t.scope == scope {
+			delete(s.tokens, h)
+		}
+	}
+
+	return nil
+}
+
+// ConsumeToken deletes an unexpired token of the given scope and returns
+// the id of its user, so the token can be used only once.
+func (s *Storage) ConsumeToken(ctx context.Context, tokenPlainText string, scope string) (int64, error) {
+	const op = "memory.ConsumeToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := hashOf(tokenPlainText)
+	t, ok := s.tokens[h]
+	if !ok || t.scope != scope || !t.expiry.After(time.Now()) {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	delete(s.tokens, h)
+
+	return t.userID, nil
+}
+
+// ScopedTokenUser returns the user of an unexpired token of the given scope
+// without consuming it.
+func (s *Storage) ScopedTokenUser(ctx context.Context, tokenPlainText string, scope string) (int64, error) {
+	const op = "memory.ScopedTokenUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[hashOf(tokenPlainText)]
+	if !ok || t.scope != scope || !t.expiry.After(time.Now()) {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+
+	return t.userID, nil
+}
+
+// RevokeToken revokes a single access token and returns the refresh token
+// family it was issued with.
+func (s *Storage) RevokeToken(ctx context.Context, tokenPlainText string) (string, error) {
+	const op = "memory.RevokeToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[hashOf(tokenPlainText)]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	t.revoked = true
+
+	return t.familyID, nil
+}
+
+// RevokeUserTokens revokes every access and refresh token of the user and
+// ends all of their sessions.
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.userID == userID {
+			t.revoked = true
+		}
+	}
+	for _, t := range s.refreshTokens {
+		if t.UserID == userID {
+			t.Revoked = true
+		}
+	}
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// RevokedTokens returns the hashes of the revoked access and client tokens
+// that have not expired yet.
+func (s *Storage) RevokedTokens(ctx context.Context) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var hashes [][]byte
+	for h, t := range s.tokens {
+		if t.revoked && t.expiry.After(now) && t.scope == storage.ScopeAuthentication {
+			hashes = append(hashes, append([]byte(nil), h[:]...))
+		}
+	}
+	for h, t := range s.clientTokens {
+		if t.revoked && t.expiry.After(now) {
+			hashes = append(hashes, append([]byte(nil), h[:]...))
+		}
+	}
+
+	return hashes, nil
+}
+
+func (s *Storage) SaveRefreshToken(
+	ctx context.Context,
+	tokenPlainText string,
+	userID int64,
+	appID int,
+	familyID string,
+	expiry time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshTokens[hashOf(tokenPlainText)] = &models.RefreshToken{
+		UserID:   userID,
+		AppID:    appID,
+		FamilyID: familyID,
+		Expiry:   expiry,
+	}
+
+	return nil
+}
+
+func (s *Storage) RefreshToken(ctx context.Context, tokenPlainText string) (models.RefreshToken, error) {
+	const op = "memory.RefreshToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refreshTokens[hashOf(tokenPlainText)]
+	if !ok {
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+
+	return *t, nil
+}
+
+// UseRefreshToken marks the token as used. It reports false when the token
+// was already used or revoked.
+func (s *Storage) UseRefreshToken(ctx context.Context, tokenPlainText string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refreshTokens[hashOf(tokenPlainText)]
+	if !ok || t.Used || t.Revoked {
+		return false, nil
+	}
+	t.Used = true
+
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes the access and refresh tokens of the
+// family and ends its session.
+func (s *Storage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.familyID == familyID {
+			t.revoked = true
+		}
+	}
+	for _, t := range s.refreshTokens {
+		if t.FamilyID == familyID {
+			t.Revoked = true
+		}
+	}
+	delete(s.sessions, familyID)
+
+	return nil
+}
+
+func (s *Storage) SaveClientToken(ctx context.Context, tokenPlainText string, t models.ClientToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clientTokens[hashOf(tokenPlainText)] = &clientToken{appID: t.AppID, scope: t.Scope, expiry: t.Expiry}
+
+	return nil
+}
+
+// ClientToken returns the unexpired, unrevoked client token.
+func (s *Storage) ClientToken(ctx context.Context, tokenPlainText string) (models.ClientToken, error) {
+	const op = "memory.ClientToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.clientTokens[hashOf(tokenPlainText)]
+	if !ok || t.revoked || !t.expiry.After(time.Now()) {
+		return models.ClientToken{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+
+	return models.ClientToken{AppID: t.appID, Scope: t.scope, Expiry: t.expiry}, nil
+}
+
+func (s *Storage) RevokeClientToken(ctx context.Context, tokenPlainText string) error {
+	const op = "memory.RevokeClientToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.clientTokens[hashOf(tokenPlainText)]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	t.revoked = true
+
+	return nil
+}
+
+// SaveSession creates the session of a new login, or updates the client
+// details and expiry of an existing one when its tokens are refreshed.
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if stored, ok := s.sessions[session.ID]; ok {
+		stored.IP = session.IP
+		stored.UserAgent = session.UserAgent
+		stored.LastSeenAt = now
+		stored.Expiry = session.Expiry
+		return nil
+	}
+
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	s.sessions[session.ID] = &session
+
+	return nil
+}
+
+// Sessions returns the unexpired sessions of the user, most recently seen
+// first.
+func (s *Storage) Sessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Expiry.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+
+	return sessions, nil
+}
+
+func (s *Storage) Session(ctx context.Context, id string) (models.Session, error) {
+	const op = "memory.Session"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+
+	return *session, nil
+}
+
+// TouchSession bumps the last-seen time of the session the access token
+// belongs to.
+func (s *Storage) TouchSession(ctx context.Context, tokenPlainText string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[hashOf(tokenPlainText)]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	if session, ok := s.sessions[t.familyID]; ok && session.LastSeenAt.Before(now.Add(-lastSeenResolution)) {
+		session.LastSeenAt = now
+	}
+
+	return nil
+}
+
+// RevokeSession ends a session of the user: the session is deleted and the
+// access and refresh tokens of its family are revoked.
+func (s *Storage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "memory.RevokeSession"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || session.UserID != userID {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+	delete(s.sessions, sessionID)
+
+	for _, t := range s.tokens {
+		if t.familyID == sessionID {
+			t.revoked = true
+		}
+	}
+	for _, t := range s.refreshTokens {
+		if t.FamilyID == sessionID {
+			t.Revoked = true
+		}
+	}
+
+	return nil
+}
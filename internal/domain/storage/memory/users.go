@@ -0,0 +1,406 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+)
+
+// SaveUser creates an inactive user with the user role.
+func (s *Storage) SaveUser(ctx context.Context, fname string, lname string, email string, passHash []byte) (int64, error) {
+	const op = "memory.SaveUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByEmail(email) != nil {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+
+	s.nextUserID++
+	s.users[s.nextUserID] = &models.User{
+		ID:           s.nextUserID,
+		Fname:        fname,
+		Lname:        lname,
+		Email:        email,
+		PasswordHash: models.Password{Hash: slices.Clone(passHash)},
+	}
+	s.userRoles[s.nextUserID] = map[string]bool{"user": true}
+
+	return s.nextUserID, nil
+}
+
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	const op = "memory.GetUserByEmail"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByEmail(email)
+	if user == nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "memory.GetUserByID"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+func (s *Storage) ActivateUser(ctx context.Context, userID int64) error {
+	const op = "memory.ActivateUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	user.Activated = true
+
+	return nil
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, userID int64, passHash []byte) error {
+	const op = "memory.UpdatePassword"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	user.PasswordHash = models.Password{Hash: slices.Clone(passHash)}
+
+	return nil
+}
+
+// GetUser implements the user service storage. Like the Postgres storage
+// it reports unknown users with sql.ErrNoRows.
+func (s *Storage) GetUser(ctx context.Context, userID int64) (*models.User, error) {
+	const op = "memory.GetUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, sql.ErrNoRows)
+	}
+
+	found := copyUser(user)
+	return &found, nil
+}
+
+// UpdateUser updates the names, email, password hash and activation of the
+// user.
+func (s *Storage) UpdateUser(ctx context.Context, user models.User) error {
+	const op = "memory.UpdateUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[user.ID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRecordNotFound)
+	}
+	if other := s.userByEmail(user.Email); other != nil && other.ID != user.ID {
+		return fmt.Errorf("%s: %w", op, storage.ErrDuplicateEmail)
+	}
+
+	stored.Fname = user.Fname
+	stored.Lname = user.Lname
+	stored.Email = user.Email
+	stored.PasswordHash = models.Password{Hash: slices.Clone(user.PasswordHash.Hash)}
+	stored.Activated = user.Activated
+
+	return nil
+}
+
+// DeleteUser deletes the user together with everything that belongs to
+// them.
+func (s *Storage) DeleteUser(ctx context.Context, userID int64) error {
+	const op = "memory.DeleteUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRecordNotFound)
+	}
+
+	delete(s.users, userID)
+	delete(s.userRoles, userID)
+	delete(s.totps, userID)
+
+	for m := range s.members {
+		if m.userID == userID {
+			s.deleteMembership(m)
+		}
+	}
+	for m := range s.consents {
+		if m.userID == userID {
+			delete(s.consents, m)
+		}
+	}
+	for h, t := range s.tokens {
+		if t.userID == userID {
+			delete(s.tokens, h)
+		}
+	}
+	for h, t := range s.refreshTokens {
+		if t.UserID == userID {
+			delete(s.refreshTokens, h)
+		}
+	}
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	for h, code := range s.codes {
+		if code.UserID == userID {
+			delete(s.codes, h)
+		}
+	}
+	s.deleteRecoveryCodes(userID)
+	for h, ws := range s.webAuthnSessions {
+		if ws.UserID == userID {
+			delete(s.webAuthnSessions, h)
+		}
+	}
+
+	credentials := s.webAuthnCredentials[:0]
+	for _, credential := range s.webAuthnCredentials {
+		if credential.UserID != userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	s.webAuthnCredentials = credentials
+
+	return nil
+}
+
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	const op = "memory.IsAdmin"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return false, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return s.userRoles[userID]["admin"], nil
+}
+
+func (s *Storage) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedKeys(s.userRoles[userID]), nil
+}
+
+func (s *Storage) UserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permissions := make(map[string]bool)
+	for role := range s.userRoles[userID] {
+		for _, permission := range rolePermissions[role] {
+			permissions[permission] = true
+		}
+	}
+
+	return sortedKeys(permissions), nil
+}
+
+func (s *Storage) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for role := range s.userRoles[userID] {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (s *Storage) AssignRole(ctx context.Context, userID int64, role string) error {
+	const op = "memory.AssignRole"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+
+	if s.userRoles[userID] == nil {
+		s.userRoles[userID] = make(map[string]bool)
+	}
+	s.userRoles[userID][role] = true
+
+	return nil
+}
+
+func (s *Storage) RevokeRole(ctx context.Context, userID int64, role string) error {
+	const op = "memory.RevokeRole"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	delete(s.userRoles[userID], role)
+
+	return nil
+}
+
+func (s *Storage) IsAppMember(ctx context.Context, appID int, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.members[membership{appID: appID, userID: userID}], nil
+}
+
+func (s *Storage) AddAppMember(ctx context.Context, appID int, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members[membership{appID: appID, userID: userID}] = true
+
+	return nil
+}
+
+// RemoveAppMember removes the membership together with the app roles of the
+// user, revokes the access and refresh tokens issued for the app and ends
+// the sessions in it.
+func (s *Storage) RemoveAppMember(ctx context.Context, appID int, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteMembership(membership{appID: appID, userID: userID})
+
+	families := make(map[string]bool)
+	for id, session := range s.sessions {
+		if session.AppID == appID && session.UserID == userID {
+			families[id] = true
+			delete(s.sessions, id)
+		}
+	}
+	for _, t := range s.refreshTokens {
+		if t.AppID == appID && t.UserID == userID {
+			families[t.FamilyID] = true
+			t.Revoked = true
+		}
+	}
+	for _, t := range s.tokens {
+		if t.userID == userID && families[t.familyID] {
+			t.revoked = true
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) AppRoles(ctx context.Context, appID int, userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedKeys(s.appRoles[membership{appID: appID, userID: userID}]), nil
+}
+
+// AssignAppRole grants the role within the app. The user must already be a
+// member of the app.
+func (s *Storage) AssignAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	const op = "memory.AssignAppRole"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := membership{appID: appID, userID: userID}
+	if !s.members[m] {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotAppMember)
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+
+	if s.appRoles[m] == nil {
+		s.appRoles[m] = make(map[string]bool)
+	}
+	s.appRoles[m][role] = true
+
+	return nil
+}
+
+func (s *Storage) RevokeAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	const op = "memory.RevokeAppRole"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	delete(s.appRoles[membership{appID: appID, userID: userID}], role)
+
+	return nil
+}
+
+func (s *Storage) userByEmail(email string) *models.User {
+	for _, user := range s.users {
+		if user.Email == email {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) deleteMembership(m membership) {
+	delete(s.members, m)
+	delete(s.appRoles, m)
+}
+
+func copyUser(user *models.User) models.User {
+	found := *user
+	found.PasswordHash = models.Password{Hash: slices.Clone(user.PasswordHash.Hash)}
+
+	return found
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+)
+
+// SaveTOTP starts a new, unconfirmed enrollment of the user, replacing any
+// previous one.
+func (s *AuthStorage) SaveTOTP(ctx context.Context, userID int64, secret string) error {
+	const op = "storage.SaveTOTP"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_totp(user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, confirmed = false, last_counter = 0, created_at = now()`,
+		userID, secret,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) TOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	const op = "storage.TOTP"
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT user_id, secret, confirmed, last_counter
+		FROM user_totp
+		WHERE user_id = $1`,
+		userID,
+	)
+
+	var totp models.TOTP
+	if err := row.Scan(&totp.UserID, &totp.Secret, &totp.Confirmed, &totp.LastCounter); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, fmt.Errorf("%s: %w", op, ErrTOTPNotFound)
+		}
+
+		return models.TOTP{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return totp, nil
+}
+
+// ConfirmTOTP enables the enrollment and replaces the recovery codes of the
+// user with the given ones.
+func (s *AuthStorage) ConfirmTOTP(ctx context.Context, userID int64, counter uint64, recoveryCodes []string) error {
+	const op = "storage.ConfirmTOTP"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_totp SET confirmed = true, last_counter = $2
+		WHERE user_id = $1`,
+		userID, counter,
+	)
+	if err != nil {
+		return fail(err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fail(err)
+	} else if n == 0 {
+		return fail(ErrTOTPNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fail(err)
+	}
+
+	for _, code := range recoveryCodes {
+		codeHash := sha256.Sum256([]byte(code))
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO mfa_recovery_codes(hash, user_id) VALUES ($1, $2)`,
+			codeHash[:], userID,
+		); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
+// UseTOTPCounter records counter as the last accepted period. It reports
+// false when a code of the same or a later period was accepted before, so
+// every code works only once.
+func (s *AuthStorage) UseTOTPCounter(ctx context.Context, userID int64, counter uint64) (bool, error) {
+	const op = "storage.UseTOTPCounter"
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_totp SET last_counter = $2
+		WHERE user_id = $1 AND confirmed AND last_counter < $2`,
+		userID, counter,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks the recovery code as used. It reports false when
+// the code does not belong to the user or was used before.
+func (s *AuthStorage) UseRecoveryCode(ctx context.Context, userID int64, code string) (bool, error) {
+	const op = "storage.UseRecoveryCode"
+	codeHash := sha256.Sum256([]byte(code))
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes SET used = true
+		WHERE hash = $1 AND user_id = $2 AND NOT used`,
+		codeHash[:], userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// DeleteTOTP disables two-factor authentication for the user.
+func (s *AuthStorage) DeleteTOTP(ctx context.Context, userID int64) error {
+	const op = "storage.DeleteTOTP"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fail(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+)
+
+func (s *AuthStorage) SaveAuthorizationCode(ctx context.Context, codePlainText string, code models.AuthorizationCode) error {
+	const op = "storage.SaveAuthorizationCode"
+	codeHash := sha256.Sum256([]byte(codePlainText))
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_codes(hash, app_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		codeHash[:], code.AppID, code.UserID, code.RedirectURI, code.Scope,
+		code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.Expiry,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode deletes the unexpired code and returns it, so a
+// code can be exchanged only once.
+func (s *AuthStorage) ConsumeAuthorizationCode(ctx context.Context, codePlainText string) (models.AuthorizationCode, error) {
+	const op = "storage.ConsumeAuthorizationCode"
+	codeHash := sha256.Sum256([]byte(codePlainText))
+
+	row := s.db.QueryRowContext(ctx, `
+		DELETE FROM oauth_codes
+		WHERE hash = $1 AND expiry > now()
+		RETURNING app_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, expiry`,
+		codeHash[:],
+	)
+
+	var code models.AuthorizationCode
+	err := row.Scan(
+		&code.AppID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.Nonce,
+		&code.Expiry,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, ErrTokenNotFound)
+		}
+
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// ConsentScope returns the scope the user consented to for the app. It
+// reports false when the user has not consented yet.
+func (s *AuthStorage) ConsentScope(ctx context.Context, userID int64, appID int) (string, bool, error) {
+	const op = "storage.ConsentScope"
+
+	row := s.db.QueryRowContext(ctx, `SELECT scope FROM oauth_consents WHERE user_id = $1 AND app_id = $2`, userID, appID)
+
+	var scope string
+	if err := row.Scan(&scope); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+
+		return "", false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scope, true, nil
+}
+
+func (s *AuthStorage) SaveConsent(ctx context.Context, userID int64, appID int, scope string) error {
+	const op = "storage.SaveConsent"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_consents(user_id, app_id, scope) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, app_id) DO UPDATE SET scope = EXCLUDED.scope, created_at = now()`,
+		userID, appID, scope,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+func (s *AuthStorage) SaveRefreshToken(
+	ctx context.Context,
+	tokenPlainText string,
+	userID int64,
+	appID int,
+	familyID string,
+	expiry time.Time,
+) error {
+	const op = "storage.SaveRefreshToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens(hash, user_id, app_id, family_id, expiry)
+		VALUES ($1, $2, $3, $4, $5)`,
+		tokenHash[:], userID, appID, familyID, expiry,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) RefreshToken(ctx context.Context, tokenPlainText string) (models.RefreshToken, error) {
+	const op = "storage.RefreshToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT user_id, app_id, family_id, expiry, used, revoked
+		FROM refresh_tokens
+		WHERE hash = $1`,
+		tokenHash[:],
+	)
+
+	var token models.RefreshToken
+	err := row.Scan(&token.UserID, &token.AppID, &token.FamilyID, &token.Expiry, &token.Used, &token.Revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RefreshToken{}, fmt.Errorf("%s: %w", op, ErrTokenNotFound)
+		}
+
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken marks the token as used. It reports false when the token
+// was already used or revoked, which happens when two requests race to
+// rotate the same token.
+func (s *AuthStorage) UseRefreshToken(ctx context.Context, tokenPlainText string) (bool, error) {
+	const op = "storage.UseRefreshToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET used = true
+		WHERE hash = $1 AND used = false AND revoked = false`,
+		tokenHash[:],
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes the access and refresh tokens of the
+// family and ends its session.
+func (s *AuthStorage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	const op = "storage.RevokeRefreshTokenFamily"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE tokens SET revoked = true WHERE family_id = $1`, familyID); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = true WHERE family_id = $1`, familyID); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, familyID); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
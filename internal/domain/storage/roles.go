@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (s *AuthStorage) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	const op = "storage.UserRoles"
+
+	roles, err := s.names(ctx, `
+		SELECT r.name FROM roles r
+		INNER JOIN user_roles ur ON ur.role_id = r.id
+		WHERE ur.user_id = $1
+		ORDER BY r.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (s *AuthStorage) UserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	const op = "storage.UserPermissions"
+
+	permissions, err := s.names(ctx, `
+		SELECT DISTINCT p.name FROM permissions p
+		INNER JOIN role_permissions rp ON rp.permission_id = p.id
+		INNER JOIN user_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id = $1
+		ORDER BY p.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+func (s *AuthStorage) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	const op = "storage.HasPermission"
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_roles ur
+			INNER JOIN role_permissions rp ON rp.role_id = ur.role_id
+			INNER JOIN permissions p ON p.id = rp.permission_id
+			WHERE ur.user_id = $1 AND p.name = $2
+		)`,
+		userID, permission,
+	)
+
+	var has bool
+	if err := row.Scan(&has); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return has, nil
+}
+
+func (s *AuthStorage) AssignRole(ctx context.Context, userID int64, role string) error {
+	const op = "storage.AssignRole"
+
+	if _, err := s.GetUserByID(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	roleID, err := s.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO user_roles(user_id, role_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		userID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) RevokeRole(ctx context.Context, userID int64, role string) error {
+	const op = "storage.RevokeRole"
+
+	roleID, err := s.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`, userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) roleID(ctx context.Context, role string) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM roles WHERE name = $1`, role).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRoleNotFound
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *AuthStorage) names(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+// lastSeenResolution limits how often a session's last-seen time is
+// written, since it is bumped on every authenticated request.
+const lastSeenResolution = time.Minute
+
+// SaveSession creates the session of a new login, or updates the client
+// details and expiry of an existing one when its tokens are refreshed. The
+// scope of a session never changes.
+func (s *AuthStorage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.SaveSession"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sessions(id, user_id, app_id, ip, user_agent, expiry, scope)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE
+		SET ip = EXCLUDED.ip,
+		    user_agent = EXCLUDED.user_agent,
+		    last_seen_at = now(),
+		    expiry = EXCLUDED.expiry`,
+		session.ID, session.UserID, session.AppID, session.IP, session.UserAgent, session.Expiry, session.Scope,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Sessions returns the unexpired sessions of the user, most recently seen
+// first.
+func (s *AuthStorage) Sessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "storage.Sessions"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, app_id, ip, user_agent, created_at, last_seen_at, expiry, scope
+		FROM sessions
+		WHERE user_id = $1 AND expiry > now()
+		ORDER BY last_seen_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.AppID,
+			&session.IP,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.Expiry,
+			&session.Scope,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (s *AuthStorage) Session(ctx context.Context, id string) (models.Session, error) {
+	const op = "storage.Session"
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, app_id, ip, user_agent, created_at, last_seen_at, expiry, scope
+		FROM sessions
+		WHERE id = $1`,
+		id,
+	)
+
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.AppID,
+		&session.IP,
+		&session.UserAgent,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.Expiry,
+		&session.Scope,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// TouchSession bumps the last-seen time of the session the access token
+// belongs to.
+func (s *AuthStorage) TouchSession(ctx context.Context, tokenPlainText string) error {
+	const op = "storage.TouchSession"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at = now()
+		WHERE id = (SELECT family_id FROM tokens WHERE hash = $1)
+		  AND last_seen_at < now() - make_interval(secs => $2)`,
+		tokenHash[:], lastSeenResolution.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeSession ends a session of the user: the session is deleted and the
+// access and refresh tokens of its family are revoked.
+func (s *AuthStorage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "storage.RevokeSession"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return fail(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fail(err)
+	}
+	if rowsAffected == 0 {
+		return fail(ErrSessionNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE tokens SET revoked = true WHERE family_id = $1`, sessionID); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = true WHERE family_id = $1`, sessionID); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+// AppSigningKeys returns the keys of the app that have not been retired yet.
+func (s *AuthStorage) AppSigningKeys(ctx context.Context, appID int) ([]models.SigningKey, error) {
+	const op = "storage.AppSigningKeys"
+
+	keys, err := s.signingKeys(ctx, `
+		SELECT kid, app_id, algorithm, private_key, active, created_at, retire_at
+		FROM signing_keys
+		WHERE app_id = $1 AND (retire_at IS NULL OR retire_at > now())
+		ORDER BY created_at DESC`,
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// SigningKeys returns the keys of every app that have not been retired yet.
+func (s *AuthStorage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "storage.SigningKeys"
+
+	keys, err := s.signingKeys(ctx, `
+		SELECT kid, app_id, algorithm, private_key, active, created_at, retire_at
+		FROM signing_keys
+		WHERE retire_at IS NULL OR retire_at > now()
+		ORDER BY app_id, created_at DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *AuthStorage) signingKeys(ctx context.Context, query string, args ...any) ([]models.SigningKey, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		err := rows.Scan(&key.ID, &key.AppID, &key.Algorithm, &key.PrivateKey, &key.Active, &key.CreatedAt, &key.RetireAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RotateSigningKey makes key the active key of its app. The previously
+// active key keeps verifying tokens until retireAt.
+func (s *AuthStorage) RotateSigningKey(ctx context.Context, key models.SigningKey, retireAt time.Time) error {
+	const op = "storage.RotateSigningKey"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE signing_keys SET active = false, retire_at = $2
+		WHERE app_id = $1 AND active`,
+		key.AppID, retireAt,
+	)
+	if err != nil {
+		return fail(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO signing_keys(kid, app_id, algorithm, private_key, active)
+		VALUES ($1, $2, $3, $4, true)`,
+		key.ID, key.AppID, key.Algorithm, key.PrivateKey,
+	)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
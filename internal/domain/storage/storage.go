@@ -10,7 +10,15 @@ var (
 	ErrUserExists    = errors.New("user already exists")
 	ErrUserNotFound  = errors.New("user not found")
 	ErrAppNotFound   = errors.New("app not found")
+	ErrAppExists     = errors.New("app already exists")
 	ErrTokenNotSaved = errors.New("token not saved")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrRoleNotFound  = errors.New("role not found")
+	ErrNotAppMember  = errors.New("user is not a member of the app")
+	ErrTOTPNotFound  = errors.New("totp not found")
+
+	ErrCredentialExists = errors.New("credential already registered")
+	ErrSessionNotFound  = errors.New("session not found")
 )
 
 func NewAuthStorage(dsn string) (*AuthStorage, error) {
@@ -11,6 +11,17 @@ import (
 	"time"
 )
 
+const (
+	ScopeAuthentication = "authentication"
+	ScopeActivation     = "activation"
+	ScopePasswordReset  = "password-reset"
+	ScopeMFA            = "mfa"
+	// ScopeConsent tokens carry a signed-in user from the login step of
+	// the authorization endpoint to its consent step. The app id is
+	// appended to the scope.
+	ScopeConsent = "consent"
+)
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
@@ -19,43 +30,39 @@ type Token struct {
 	Scope     string    `json:"-"`
 }
 
-func (s *AuthStorage) SaveToken(ctx context.Context, tokenPlainText string, userId int64) (bool, error) {
+// SaveToken stores an access token. expiry must be the exp claim of the
+// token so that both stop being valid at the same time.
+func (s *AuthStorage) SaveToken(
+	ctx context.Context,
+	tokenPlainText string,
+	userId int64,
+	familyID string,
+	expiry time.Time,
+) (bool, error) {
 	const op = "storage.SaveToken"
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
-	fail := func(e error) error {
-		return fmt.Errorf("%s: %v", op, e)
-	}
-	stmt, err := s.db.Prepare(`
-								INSERT INTO tokens(hash, user_id, expiry) 
-								VALUES ($1, $2, $3)
-								`)
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO tokens(hash, user_id, expiry, family_id)
+		VALUES ($1, $2, $3, $4)`,
+		tokenHash[:], userId, expiry, familyID,
+	)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return false, fmt.Errorf("%s: %w", op, ErrTokenNotSaved)
-		default:
-			return false, fmt.Errorf("%s: %w", op, err)
-		}
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return false, fail(err)
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
-	defer tx.Rollback()
 
-	row := stmt.QueryRowContext(ctx, tokenHash[:], userId, time.Now().Add(time.Hour))
-
-	if row.Err() != nil {
-		return false, fail(err)
-	}
-	return true, nil
+	return rowsAffected == 1, nil
 }
 
 func (s *AuthStorage) IsAuthenticated(ctx context.Context, tokenPlainText string) (bool, int64, error) {
 	const op = "storage.IsAuthenticated"
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
-	stmt, err := s.db.Prepare(`SELECT id,fname,lname,email,password_hash,activated FROM users INNER JOIN tokens t ON users.id = t.user_id WHERE t.hash = $1 AND t.expiry > $2`)
+	stmt, err := s.db.Prepare(`SELECT id,fname,lname,email,password_hash,activated FROM users INNER JOIN tokens t ON users.id = t.user_id WHERE t.hash = $1 AND t.expiry > $2 AND t.scope = $3 AND NOT t.revoked`)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -65,7 +72,7 @@ func (s *AuthStorage) IsAuthenticated(ctx context.Context, tokenPlainText string
 		}
 	}
 
-	row := stmt.QueryRowContext(ctx, tokenHash[:], time.Now())
+	row := stmt.QueryRowContext(ctx, tokenHash[:], time.Now(), ScopeAuthentication)
 
 	if errors.Is(row.Err(), sql.ErrNoRows) {
 		return false, 0, nil
@@ -91,39 +98,199 @@ func (s *AuthStorage) IsAuthenticated(ctx context.Context, tokenPlainText string
 	return true, user.ID, nil
 }
 
-func (s *AuthStorage) CheckTokens() {
-	for {
-		queryToGetExpiredUserIds := `
-			SELECT u.user_id 
-			FROM tokens u 
-			WHERE expiry < now()`
-
-		rows, err := s.db.Query(queryToGetExpiredUserIds)
-		if err != nil {
-			log.Printf("failed to get expired users")
-			return
+// SaveScopedToken stores a single-use token such as an activation token.
+func (s *AuthStorage) SaveScopedToken(
+	ctx context.Context,
+	tokenPlainText string,
+	userID int64,
+	scope string,
+	expiry time.Time,
+) error {
+	const op = "storage.SaveScopedToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO tokens(hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)`,
+		tokenHash[:], userID, expiry, scope,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) DeleteScopedTokens(ctx context.Context, userID int64, scope string) error {
+	const op = "storage.DeleteScopedTokens"
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1 AND scope = $2`, userID, scope)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeToken deletes an unexpired token of the given scope and returns
+// the id of its user, so the token can be used only once.
+func (s *AuthStorage) ConsumeToken(ctx context.Context, tokenPlainText string, scope string) (int64, error) {
+	const op = "storage.ConsumeToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	row := s.db.QueryRowContext(ctx, `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > now()
+		RETURNING user_id`,
+		tokenHash[:], scope,
+	)
+
+	var userID int64
+	if err := row.Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, ErrTokenNotFound)
 		}
 
-		var userInfos []*models.User
-		for rows.Next() {
-			var userInfo models.User
-			err := rows.Scan(&userInfo.ID)
-			if err != nil {
-				log.Printf("failed to scan expired user")
-				return
-			}
-			userInfos = append(userInfos, &userInfo)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// ScopedTokenUser returns the user of an unexpired token of the given scope
+// without consuming it.
+func (s *AuthStorage) ScopedTokenUser(ctx context.Context, tokenPlainText string, scope string) (int64, error) {
+	const op = "storage.ScopedTokenUser"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT user_id FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > now()`,
+		tokenHash[:], scope,
+	)
+
+	var userID int64
+	if err := row.Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, ErrTokenNotFound)
 		}
 
-		queryToDeleteExpiredTokens := `
-				DELETE FROM tokens
-				WHERE user_id = $1`
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 
-		for _, ui := range userInfos {
-			_, err := s.db.Exec(queryToDeleteExpiredTokens, ui.ID)
-			if err != nil {
-				log.Printf("failed to delete expired user with id = %d", ui.ID)
-				return
+	return userID, nil
+}
+
+// RevokeToken revokes a single access token and returns the refresh token
+// family it was issued with.
+func (s *AuthStorage) RevokeToken(ctx context.Context, tokenPlainText string) (string, error) {
+	const op = "storage.RevokeToken"
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	row := s.db.QueryRowContext(ctx, `UPDATE tokens SET revoked = true WHERE hash = $1 RETURNING family_id`, tokenHash[:])
+
+	var familyID string
+	if err := row.Scan(&familyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, ErrTokenNotFound)
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return familyID, nil
+}
+
+// RevokedTokens returns the hashes of the revoked access and client tokens
+// that have not expired yet.
+func (s *AuthStorage) RevokedTokens(ctx context.Context) ([][]byte, error) {
+	const op = "storage.RevokedTokens"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT hash FROM tokens WHERE revoked AND expiry > now() AND scope = $1
+		UNION ALL
+		SELECT hash FROM client_tokens WHERE revoked AND expiry > now()`,
+		ScopeAuthentication,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hashes, nil
+}
+
+// RevokeUserTokens revokes every access and refresh token of the user and
+// ends all of their sessions.
+func (s *AuthStorage) RevokeUserTokens(ctx context.Context, userID int64) error {
+	const op = "storage.RevokeUserTokens"
+	fail := func(e error) error {
+		return fmt.Errorf("%s: %w", op, e)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE tokens SET revoked = true WHERE user_id = $1`, userID); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = true WHERE user_id = $1`, userID); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
+// expiredRows are the deletes CheckTokens runs. Revoked tokens are kept
+// until they expire, since the revocation list of the hybrid
+// verification mode is built from them.
+var expiredRows = []struct {
+	name  string
+	query string
+}{
+	{"tokens", `DELETE FROM tokens WHERE expiry < now()`},
+	{"client tokens", `DELETE FROM client_tokens WHERE expiry < now()`},
+	{"webauthn sessions", `DELETE FROM webauthn_sessions WHERE expiry < now()`},
+	{"sessions", `DELETE FROM sessions WHERE expiry < now()`},
+	{"login attempts", `
+		DELETE FROM login_attempts
+		WHERE last_failure < now() - interval '1 day'
+		  AND (blocked_until IS NULL OR blocked_until < now())`},
+}
+
+// CheckTokens deletes expired tokens, sessions and stale login attempts
+// periodically. It never returns; failed deletes are retried on the next
+// run.
+func (s *AuthStorage) CheckTokens() {
+	for {
+		for _, rows := range expiredRows {
+			if _, err := s.db.Exec(rows.query); err != nil {
+				log.Printf("failed to delete expired %s: %v", rows.name, err)
 			}
 		}
 
@@ -24,7 +24,7 @@ func (us *UserStorage) GetUser(ctx context.Context, id int64) (*models.User, err
 	fail := func(e error) error {
 		return fmt.Errorf("%s: %w", op, e)
 	}
-	stmt, err := us.db.Prepare(`SELECT * FROM users WHERE id = $1`)
+	stmt, err := us.db.Prepare(`SELECT id, fname, lname, email, password_hash, activated FROM users WHERE id = $1`)
 	if err != nil {
 		return nil, fail(err)
 	}
@@ -33,15 +33,15 @@ func (us *UserStorage) GetUser(ctx context.Context, id int64) (*models.User, err
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, fail(sql.ErrNoRows)
 	}
-	err = row.Scan(&User.ID, &User.Fname, &User.Lname, &User.Email, &User.PasswordHash.Hash, &User.Role, &User.Activated)
+	err = row.Scan(&User.ID, &User.Fname, &User.Lname, &User.Email, &User.PasswordHash.Hash, &User.Activated)
 	if err != nil {
 		return nil, fail(err)
 	}
 	return &User, nil
 }
 func (us *UserStorage) UpdateUser(ctx context.Context, user models.User) error {
-	query := `UPDATE users SET fname=$1,lname=$2,email=$3,password_hash=$4 WHERE id=$5`
-	args := []any{user.Fname, user.Lname, user.Email, user.PasswordHash.Hash, user.ID}
+	query := `UPDATE users SET fname=$1,lname=$2,email=$3,password_hash=$4,activated=$5 WHERE id=$6`
+	args := []any{user.Fname, user.Lname, user.Email, user.PasswordHash.Hash, user.Activated, user.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := us.db.QueryRowContext(ctx, query, args...)
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"sso/internal/domain/models"
+	"time"
+)
+
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+func (s *AuthStorage) SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	const op = "storage.SaveWebAuthnCredential"
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webauthn_credentials(
+			id, user_id, public_key, attestation_type, transports, aaguid,
+			sign_count, backup_eligible, backup_state
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		credential.ID,
+		credential.UserID,
+		credential.PublicKey,
+		credential.AttestationType,
+		pq.Array(credential.Transports),
+		credential.AAGUID,
+		int64(credential.SignCount),
+		credential.BackupEligible,
+		credential.BackupState,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, ErrCredentialExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	const op = "storage.WebAuthnCredentials"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, public_key, attestation_type, transports, aaguid,
+		       sign_count, backup_eligible, backup_state
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var credentials []models.WebAuthnCredential
+	for rows.Next() {
+		var (
+			credential models.WebAuthnCredential
+			signCount  int64
+		)
+		err := rows.Scan(
+			&credential.ID,
+			&credential.UserID,
+			&credential.PublicKey,
+			&credential.AttestationType,
+			pq.Array(&credential.Transports),
+			&credential.AAGUID,
+			&signCount,
+			&credential.BackupEligible,
+			&credential.BackupState,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		credential.SignCount = uint32(signCount)
+
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnCredential records a successful login with the credential.
+func (s *AuthStorage) UpdateWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	const op = "storage.UpdateWebAuthnCredential"
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials
+		SET sign_count = $1, backup_state = $2, last_used_at = now()
+		WHERE id = $3`,
+		int64(credential.SignCount), credential.BackupState, credential.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *AuthStorage) SaveWebAuthnSession(ctx context.Context, id string, session models.WebAuthnSession) error {
+	const op = "storage.SaveWebAuthnSession"
+	idHash := sha256.Sum256([]byte(id))
+
+	var userID sql.NullInt64
+	if session.UserID != 0 {
+		userID = sql.NullInt64{Int64: session.UserID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webauthn_sessions(hash, user_id, kind, data, expiry)
+		VALUES ($1, $2, $3, $4, $5)`,
+		idHash[:], userID, session.Kind, session.Data, session.Expiry,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnSession deletes and returns the unexpired session, so every
+// ceremony can be finished only once.
+func (s *AuthStorage) ConsumeWebAuthnSession(ctx context.Context, id string, kind string) (models.WebAuthnSession, error) {
+	const op = "storage.ConsumeWebAuthnSession"
+	idHash := sha256.Sum256([]byte(id))
+
+	row := s.db.QueryRowContext(ctx, `
+		DELETE FROM webauthn_sessions
+		WHERE hash = $1 AND kind = $2 AND expiry > $3
+		RETURNING user_id, kind, data, expiry`,
+		idHash[:], kind, time.Now(),
+	)
+
+	var (
+		session models.WebAuthnSession
+		userID  sql.NullInt64
+	)
+	if err := row.Scan(&userID, &session.Kind, &session.Data, &session.Expiry); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, ErrTokenNotFound)
+		}
+
+		return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+	session.UserID = userID.Int64
+
+	return session, nil
+}
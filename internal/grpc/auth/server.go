@@ -6,11 +6,31 @@ import (
 	ssov1 "github.com/DarkhanOmirbay/proto/proto/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"math"
+	"sso/internal/domain/models"
 	"sso/internal/domain/storage"
+	"sso/internal/grpc/badrequest"
+	"sso/internal/lockout"
+	"sso/internal/password"
+	authService "sso/internal/services/auth"
+	"strconv"
 )
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+// refreshTokenHeader carries the refresh token issued by Login, since
+// LoginResponse only has room for the access token. Clients exchange it at
+// the /refresh HTTP endpoint.
+const refreshTokenHeader = "x-refresh-token"
+
+// mfaTokenTrailer carries the MFA token when Login needs a second factor.
+// The call fails with FailedPrecondition, so the token travels in the
+// trailer, which is delivered with errors.
+const mfaTokenTrailer = "x-mfa-token"
+
+// retryAfterTrailer tells a throttled client how many seconds to wait
+// before the next login attempt.
+const retryAfterTrailer = "retry-after"
 
 type Auth interface {
 	Login(
@@ -18,7 +38,7 @@ type Auth interface {
 		email string,
 		password string,
 		appID int,
-	) (token string, err error)
+	) (tokens models.TokenPair, err error)
 	RegisterNewUser(
 		ctx context.Context,
 		fname string,
@@ -55,14 +75,43 @@ func (s *serverAPI) Login(
 	if req.GetAppId() == 0 {
 		return nil, status.Error(codes.InvalidArgument, "app_id is required")
 	}
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
 	if err != nil {
-		if errors.Is(err, ErrInvalidCredentials) {
+		if errors.Is(err, authService.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
 		}
+		if errors.Is(err, authService.ErrAccountLocked) {
+			setRetryAfter(ctx, err)
+			return nil, status.Error(codes.PermissionDenied, "account is temporarily locked")
+		}
+		if errors.Is(err, authService.ErrTooManyAttempts) {
+			setRetryAfter(ctx, err)
+			return nil, status.Error(codes.ResourceExhausted, "too many failed login attempts")
+		}
+		if errors.Is(err, authService.ErrUserNotActivated) {
+			return nil, status.Error(codes.FailedPrecondition, "account is not activated")
+		}
+		if errors.Is(err, authService.ErrNotAppMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not a member of the app")
+		}
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
-	return &ssov1.LoginResponse{Token: token}, nil
+	if tokens.MFAToken != "" {
+		if err := grpc.SetTrailer(ctx, metadata.Pairs(mfaTokenTrailer, tokens.MFAToken)); err != nil {
+			return nil, status.Error(codes.Internal, "failed to login")
+		}
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication required")
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(refreshTokenHeader, tokens.RefreshToken)); err != nil {
+		return nil, status.Error(codes.Internal, "failed to login")
+	}
+	return &ssov1.LoginResponse{Token: tokens.AccessToken}, nil
+}
+
+// setRetryAfter reports the lockout delay in whole seconds, rounded up.
+func setRetryAfter(ctx context.Context, err error) {
+	seconds := int64(math.Ceil(lockout.RetryAfter(err).Seconds()))
+	_ = grpc.SetTrailer(ctx, metadata.Pairs(retryAfterTrailer, strconv.FormatInt(seconds, 10)))
 }
 
 func (s *serverAPI) Register(
@@ -88,6 +137,9 @@ func (s *serverAPI) Register(
 		if errors.Is(err, storage.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, authService.ErrWeakPassword) {
+			return nil, badrequest.Password(password.Violations(err))
+		}
 
 		return nil, status.Error(codes.Internal, "failed to register user")
 	}
@@ -0,0 +1,41 @@
+// Package badrequest turns validation failures into InvalidArgument
+// statuses whose details list what failed.
+package badrequest
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sso/internal/password"
+)
+
+// WeakPasswordReason is the ErrorInfo reason of a rejected password.
+const WeakPasswordReason = "WEAK_PASSWORD"
+
+// Password returns an InvalidArgument status for a password rejected by
+// the policy. Its BadRequest detail has a field violation per failed rule,
+// and its ErrorInfo detail maps each rule to its description.
+func Password(violations []password.Violation) error {
+	st := status.New(codes.InvalidArgument, "password does not satisfy the policy")
+
+	badRequest := &errdetails.BadRequest{}
+	info := &errdetails.ErrorInfo{
+		Reason:   WeakPasswordReason,
+		Domain:   "sso",
+		Metadata: make(map[string]string, len(violations)),
+	}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: v.Description,
+		})
+		info.Metadata[v.Rule] = v.Description
+	}
+
+	withDetails, err := st.WithDetails(badRequest, info)
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
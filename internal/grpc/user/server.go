@@ -2,14 +2,17 @@ package user
 
 import (
 	"context"
+	"errors"
 	ssov1 "github.com/DarkhanOmirbay/proto/proto/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"sso/internal/grpc/badrequest"
+	"sso/internal/password"
 )
 
 type User interface {
-	EditProfile(ctx context.Context, userId int64, user ssov1.User) (string, *ssov1.User, error)
+	EditProfile(ctx context.Context, userId int64, user *ssov1.User) (string, *ssov1.User, error)
 	DeleteAccount(ctx context.Context, userId int64) (string, error)
 	ShowProfile(ctx context.Context, userId int64) (*ssov1.User, error)
 }
@@ -26,8 +29,15 @@ func (s *serverAPI) EditProfile(ctx context.Context, in *ssov1.EditProfileReques
 		return nil, status.Error(codes.InvalidArgument, "id is required")
 	}
 
-	msg, user, err := s.user.EditProfile(ctx, in.Id, *in.User)
+	if in.User == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+
+	msg, user, err := s.user.EditProfile(ctx, in.Id, in.User)
 	if err != nil {
+		if errors.Is(err, password.ErrWeakPassword) {
+			return nil, badrequest.Password(password.Violations(err))
+		}
 		return nil, err
 	}
 	return &ssov1.EditProfileResponse{Msg: msg, UpdatedUser: user}, nil
@@ -0,0 +1,120 @@
+// Package account serves the account endpoints that work without an access
+// token, using the one-time tokens mailed to the user instead.
+package account
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sso/internal/http/response"
+	"sso/internal/password"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+)
+
+type Account interface {
+	ActivateUser(ctx context.Context, token string) (int64, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+}
+
+type handler struct {
+	log     *slog.Logger
+	account Account
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, account Account) {
+	h := &handler{log: log, account: account}
+
+	mux.HandleFunc("/activate", h.post(h.Activate))
+	mux.HandleFunc("/password/forgot", h.post(h.ForgotPassword))
+	mux.HandleFunc("/password/reset", h.post(h.ResetPassword))
+}
+
+// Activate activates the account of the activation token given by the token
+// form field.
+func (h *handler) Activate(w http.ResponseWriter, r *http.Request) {
+	_, err := h.account.ActivateUser(r.Context(), r.PostForm.Get("token"))
+	switch {
+	case errors.Is(err, authService.ErrInvalidActivationToken):
+		response.Error(w, http.StatusBadRequest, "invalid or expired token")
+		return
+	case err != nil:
+		h.log.Error("failed to activate user", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword mails a password reset token to the email form field. The
+// response is the same whether or not an account uses the email.
+func (h *handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	email := r.PostForm.Get("email")
+	if email == "" {
+		response.Error(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	if err := h.account.RequestPasswordReset(r.Context(), email); err != nil {
+		h.log.Error("failed to request password reset", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type violation struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+}
+
+type weakPasswordResponse struct {
+	Error      string      `json:"error"`
+	Violations []violation `json:"violations"`
+}
+
+// ResetPassword sets the password form field as the new password of the
+// user the reset token in the token form field was mailed to.
+func (h *handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := h.account.ResetPassword(r.Context(), r.PostForm.Get("token"), r.PostForm.Get("password"))
+	switch {
+	case errors.Is(err, authService.ErrInvalidResetToken):
+		response.Error(w, http.StatusBadRequest, "invalid or expired token")
+		return
+	case errors.Is(err, authService.ErrWeakPassword):
+		resp := weakPasswordResponse{Error: "password does not satisfy the policy"}
+		for _, v := range password.Violations(err) {
+			resp.Violations = append(resp.Violations, violation{Rule: v.Rule, Description: v.Description})
+		}
+		response.JSON(w, http.StatusBadRequest, resp)
+		return
+	case err != nil:
+		h.log.Error("failed to reset password", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// post requires a POST and parses its form before passing the request on to
+// next.
+func (h *handler) post(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			response.MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			response.Error(w, http.StatusBadRequest, "malformed request body")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,299 @@
+// Package admin serves the administrative endpoints. Every endpoint takes
+// the bearer access token of a caller holding the permission it requires.
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sso/internal/authz"
+	"sso/internal/http/bearer"
+	"sso/internal/http/response"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+	"strconv"
+)
+
+type Admin interface {
+	Authenticate(ctx context.Context, token string) (authz.Principal, bool, error)
+	RevokeUserTokens(ctx context.Context, userID int64) error
+	UnlockUser(ctx context.Context, userID int64) error
+	UserRoles(ctx context.Context, userID int64) ([]string, error)
+	UserPermissions(ctx context.Context, userID int64) ([]string, error)
+	HasPermission(ctx context.Context, userID int64, permission string) (bool, error)
+	AssignRole(ctx context.Context, userID int64, role string) error
+	RevokeRole(ctx context.Context, userID int64, role string) error
+	AddAppMember(ctx context.Context, appID int, userID int64) error
+	RemoveAppMember(ctx context.Context, appID int, userID int64) error
+	AssignAppRole(ctx context.Context, appID int, userID int64, role string) error
+	RevokeAppRole(ctx context.Context, appID int, userID int64, role string) error
+}
+
+type handler struct {
+	log   *slog.Logger
+	admin Admin
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, admin Admin) {
+	h := &handler{log: log, admin: admin}
+
+	mux.HandleFunc("/admin/users/revoke-tokens", h.permitted(http.MethodPost, authz.PermTokensRevoke, h.RevokeUserTokens))
+	mux.HandleFunc("/admin/users/unlock", h.permitted(http.MethodPost, authz.PermUsersWrite, h.UnlockUser))
+	mux.HandleFunc("/admin/users/roles", h.permitted(http.MethodGet, authz.PermUsersRead, h.UserRoles))
+	mux.HandleFunc("/admin/users/permission", h.permitted(http.MethodGet, authz.PermUsersRead, h.HasPermission))
+	mux.HandleFunc("/admin/users/roles/assign", h.permitted(http.MethodPost, authz.PermRolesManage, h.AssignRole))
+	mux.HandleFunc("/admin/users/roles/revoke", h.permitted(http.MethodPost, authz.PermRolesManage, h.RevokeRole))
+	mux.HandleFunc("/admin/apps/members/add", h.permitted(http.MethodPost, authz.PermAppsManage, h.AddAppMember))
+	mux.HandleFunc("/admin/apps/members/remove", h.permitted(http.MethodPost, authz.PermAppsManage, h.RemoveAppMember))
+	mux.HandleFunc("/admin/apps/roles/assign", h.permitted(http.MethodPost, authz.PermRolesManage, h.AssignAppRole))
+	mux.HandleFunc("/admin/apps/roles/revoke", h.permitted(http.MethodPost, authz.PermRolesManage, h.RevokeAppRole))
+}
+
+// RevokeUserTokens logs the user given by the user_id form field out of
+// every session.
+func (h *handler) RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.admin.RevokeUserTokens(r.Context(), userID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser clears the failed logins of the user given by the user_id form
+// field, lifting a lockout before it expires.
+func (h *handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.admin.UnlockUser(r.Context(), userID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type rolesResponse struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserRoles returns the roles of the user given by the user_id parameter and
+// the permissions they grant.
+func (h *handler) UserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := h.admin.UserRoles(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	permissions, err := h.admin.UserPermissions(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, rolesResponse{Roles: roles, Permissions: permissions})
+}
+
+type permissionResponse struct {
+	HasPermission bool `json:"has_permission"`
+}
+
+// HasPermission reports whether the user given by the user_id parameter
+// holds the permission given by the permission parameter.
+func (h *handler) HasPermission(w http.ResponseWriter, r *http.Request) {
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	permission := r.Form.Get("permission")
+	if permission == "" {
+		response.Error(w, http.StatusBadRequest, "permission is required")
+		return
+	}
+
+	has, err := h.admin.HasPermission(r.Context(), userID, permission)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, permissionResponse{HasPermission: has})
+}
+
+// AssignRole grants the role form field to the user given by user_id. The
+// role goes into the tokens issued to the user afterwards.
+func (h *handler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, h.admin.AssignRole)
+}
+
+// RevokeRole takes the role form field away from the user given by user_id.
+func (h *handler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, h.admin.RevokeRole)
+}
+
+func (h *handler) changeRole(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, userID int64, role string) error) {
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	role := r.Form.Get("role")
+	if role == "" {
+		response.Error(w, http.StatusBadRequest, "role is required")
+		return
+	}
+
+	if err := change(r.Context(), userID, role); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddAppMember lets the user given by user_id log in to the app given by
+// app_id.
+func (h *handler) AddAppMember(w http.ResponseWriter, r *http.Request) {
+	h.changeMembership(w, r, h.admin.AddAppMember)
+}
+
+// RemoveAppMember takes the user given by user_id out of the app given by
+// app_id, together with their app roles, tokens and sessions for the app.
+func (h *handler) RemoveAppMember(w http.ResponseWriter, r *http.Request) {
+	h.changeMembership(w, r, h.admin.RemoveAppMember)
+}
+
+// AssignAppRole grants the role form field to the user given by user_id
+// within the app given by app_id. The user must be a member of the app.
+func (h *handler) AssignAppRole(w http.ResponseWriter, r *http.Request) {
+	h.changeAppRole(w, r, h.admin.AssignAppRole)
+}
+
+// RevokeAppRole takes the role form field away from the user given by
+// user_id within the app given by app_id.
+func (h *handler) RevokeAppRole(w http.ResponseWriter, r *http.Request) {
+	h.changeAppRole(w, r, h.admin.RevokeAppRole)
+}
+
+func (h *handler) changeMembership(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, appID int, userID int64) error) {
+	appID, ok := formAppID(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := change(r.Context(), appID, userID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) changeAppRole(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, appID int, userID int64, role string) error) {
+	appID, ok := formAppID(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := formUserID(w, r)
+	if !ok {
+		return
+	}
+
+	role := r.Form.Get("role")
+	if role == "" {
+		response.Error(w, http.StatusBadRequest, "role is required")
+		return
+	}
+
+	if err := change(r.Context(), appID, userID, role); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// permitted requires method and a caller holding permission, and parses the
+// form before passing the request on to next.
+func (h *handler) permitted(method string, permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			response.MethodNotAllowed(w, method)
+			return
+		}
+
+		if _, ok := bearer.Permitted(w, r, h.log, h.admin, permission); !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			response.Error(w, http.StatusBadRequest, "malformed request body")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// formUserID returns the user_id form field or query parameter. On failure
+// the error response has been written and ok is false.
+func formUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		response.Error(w, http.StatusBadRequest, "user_id is required")
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// formAppID returns the app_id form field or query parameter. On failure
+// the error response has been written and ok is false.
+func formAppID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	appID, err := strconv.Atoi(r.Form.Get("app_id"))
+	if err != nil || appID <= 0 {
+		response.Error(w, http.StatusBadRequest, "app_id is required")
+		return 0, false
+	}
+
+	return appID, true
+}
+
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authService.ErrUserNotFound):
+		response.Error(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, authService.ErrAppNotFound):
+		response.Error(w, http.StatusNotFound, "app not found")
+	case errors.Is(err, authService.ErrRoleNotFound):
+		response.Error(w, http.StatusBadRequest, "unknown role")
+	case errors.Is(err, authService.ErrNotAppMember):
+		response.Error(w, http.StatusConflict, "user is not a member of the app")
+	default:
+		h.log.Error("admin request failed", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+	}
+}
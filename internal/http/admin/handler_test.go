@@ -0,0 +1,215 @@
+package admin_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sso/internal/authz"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage/memory"
+	"sso/internal/http/admin"
+	"sso/internal/lockout"
+	"sso/internal/password"
+	"sso/internal/services/auth"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testPassword    = "correct horse battery staple"
+	testRedirectURI = "https://app.example.com/callback"
+)
+
+// newServer serves the admin endpoints of an Auth over an in-memory storage
+// with a single app, and returns the id of an admin user of that app.
+func newServer(t *testing.T) (*httptest.Server, *auth.Auth, int64) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	storage, err := memory.Open("memory://?app=test:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := storage.App(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.RedirectURIs = []string{testRedirectURI}
+	if err := storage.UpdateApp(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := auth.New(log, time.Hour, 24*time.Hour, auth.NewKeySet(key), storage,
+		auth.WithPasswordHasher(password.Bcrypt{Cost: 4}),
+		auth.WithOAuth(time.Minute, "https://sso.test"),
+		auth.WithLockout(lockout.New(lockout.NewMemoryStore(), lockout.Policy{
+			MaxFailures:  3,
+			LockDuration: time.Hour,
+			Window:       time.Hour,
+		})),
+	)
+
+	userID, err := a.RegisterNewUser(ctx, "Test", "Admin", "admin@example.com", testPassword)
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	if err := a.AssignRole(ctx, userID, authz.RoleAdmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	admin.Register(mux, log, a)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, a, userID
+}
+
+// authorize runs the authorization code flow for the admin user and returns
+// the tokens issued for scope.
+func authorize(t *testing.T, a *auth.Auth, scope string) models.TokenPair {
+	t.Helper()
+
+	ctx := context.Background()
+	req := auth.AuthorizeRequest{ClientID: 1, RedirectURI: testRedirectURI, Scope: scope}
+
+	_, consentToken, err := a.Authorize(ctx, req, "admin@example.com", testPassword, "")
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	code, err := a.Consent(ctx, req, consentToken, true)
+	if err != nil {
+		t.Fatalf("Consent: %v", err)
+	}
+
+	pair, _, err := a.ExchangeCode(ctx, 1, "secret", code, testRedirectURI, "")
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+
+	return pair
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, token string, form url.Values) int {
+	t.Helper()
+
+	target, body := srv.URL+path+"?"+form.Encode(), ""
+	if method == http.MethodPost {
+		target, body = srv.URL+path, form.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestScopedTokenPermissions(t *testing.T) {
+	srv, a, userID := newServer(t)
+	form := url.Values{"user_id": {strconv.FormatInt(userID, 10)}}
+
+	pair, err := a.Login(context.Background(), "admin@example.com", testPassword, 1)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if status := do(t, srv, http.MethodPost, "/admin/users/revoke-tokens", pair.AccessToken, form); status != http.StatusNoContent {
+		t.Fatalf("login token: status %d, want %d", status, http.StatusNoContent)
+	}
+
+	scoped := authorize(t, a, authz.PermUsersRead)
+	refreshed, err := a.Refresh(context.Background(), scoped.RefreshToken, 1)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	for name, token := range map[string]string{"issued": scoped.AccessToken, "refreshed": refreshed.AccessToken} {
+		if status := do(t, srv, http.MethodGet, "/admin/users/roles", token, form); status != http.StatusOK {
+			t.Errorf("%s token within scope: status %d, want %d", name, status, http.StatusOK)
+		}
+		if status := do(t, srv, http.MethodPost, "/admin/users/revoke-tokens", token, form); status != http.StatusForbidden {
+			t.Errorf("%s token outside scope: status %d, want %d", name, status, http.StatusForbidden)
+		}
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	ctx := context.Background()
+	srv, a, _ := newServer(t)
+
+	userID, err := a.RegisterNewUser(ctx, "Test", "User", "user@example.com", testPassword)
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := a.Login(ctx, "user@example.com", "wrong password", 1); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, auth.ErrInvalidCredentials)
+		}
+	}
+	if _, err := a.Login(ctx, "user@example.com", testPassword, 1); !errors.Is(err, auth.ErrAccountLocked) {
+		t.Fatalf("login before unlock: got %v, want %v", err, auth.ErrAccountLocked)
+	}
+
+	adminPair, err := a.Login(ctx, "admin@example.com", testPassword, 1)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	form := url.Values{"user_id": {strconv.FormatInt(userID, 10)}}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		form   url.Values
+		status int
+	}{
+		{name: "GET", method: http.MethodGet, form: form, status: http.StatusMethodNotAllowed},
+		{name: "no user", method: http.MethodPost, status: http.StatusBadRequest},
+		{name: "unknown user", method: http.MethodPost, form: url.Values{"user_id": {"999"}}, status: http.StatusNotFound},
+	} {
+		if status := do(t, srv, tt.method, "/admin/users/unlock", adminPair.AccessToken, tt.form); status != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.status)
+		}
+	}
+
+	if _, err := a.RegisterNewUser(ctx, "Test", "Other", "other@example.com", testPassword); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	otherPair, err := a.Login(ctx, "other@example.com", testPassword, 1)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if status := do(t, srv, http.MethodPost, "/admin/users/unlock", otherPair.AccessToken, form); status != http.StatusForbidden {
+		t.Errorf("user without %s: status %d, want %d", authz.PermUsersWrite, status, http.StatusForbidden)
+	}
+
+	if status := do(t, srv, http.MethodPost, "/admin/users/unlock", adminPair.AccessToken, form); status != http.StatusNoContent {
+		t.Fatalf("status %d, want %d", status, http.StatusNoContent)
+	}
+	if _, err := a.Login(ctx, "user@example.com", testPassword, 1); err != nil {
+		t.Errorf("login after unlock: %v", err)
+	}
+}
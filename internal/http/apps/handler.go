@@ -0,0 +1,316 @@
+// Package apps serves client application management. Every endpoint takes
+// the bearer access token of a caller holding the apps:manage permission.
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sso/internal/authz"
+	"sso/internal/domain/models"
+	"sso/internal/http/bearer"
+	"sso/internal/http/response"
+	appsService "sso/internal/services/apps"
+	"sso/internal/sl"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Apps interface {
+	CreateApp(ctx context.Context, app models.App) (models.App, error)
+	GetApp(ctx context.Context, appID int) (models.App, error)
+	ListApps(ctx context.Context) ([]models.App, error)
+	UpdateApp(ctx context.Context, app models.App) (models.App, error)
+	RotateAppSecret(ctx context.Context, appID int) (string, error)
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+type handler struct {
+	log           *slog.Logger
+	authenticator bearer.PrincipalAuthenticator
+	apps          Apps
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, authenticator bearer.PrincipalAuthenticator, apps Apps) {
+	h := &handler{log: log, authenticator: authenticator, apps: apps}
+
+	mux.HandleFunc("/admin/apps", h.Apps)
+	mux.HandleFunc("/admin/apps/app", h.permitted(http.MethodGet, h.Get))
+	mux.HandleFunc("/admin/apps/update", h.permitted(http.MethodPost, h.Update))
+	mux.HandleFunc("/admin/apps/rotate-secret", h.permitted(http.MethodPost, h.RotateSecret))
+	mux.HandleFunc("/admin/apps/delete", h.permitted(http.MethodPost, h.Delete))
+}
+
+type appResponse struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	Secret          string   `json:"secret,omitempty"`
+	OpenMembership  bool     `json:"open_membership"`
+	RedirectURIs    []string `json:"redirect_uris"`
+	ClientType      string   `json:"client_type"`
+	ClientScopes    []string `json:"client_scopes"`
+	AccessTokenTTL  string   `json:"access_token_ttl,omitempty"`
+	RefreshTokenTTL string   `json:"refresh_token_ttl,omitempty"`
+}
+
+type listResponse struct {
+	Apps []appResponse `json:"apps"`
+}
+
+type secretResponse struct {
+	Secret string `json:"secret"`
+}
+
+// Apps lists the apps on GET and creates one on POST. The secret of a new
+// app is only ever returned by this response and by RotateSecret.
+func (h *handler) Apps(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.permitted(http.MethodGet, h.List)(w, r)
+	case http.MethodPost:
+		h.permitted(http.MethodPost, h.Create)(w, r)
+	default:
+		response.MethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *handler) List(w http.ResponseWriter, r *http.Request) {
+	apps, err := h.apps.ListApps(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := listResponse{Apps: make([]appResponse, len(apps))}
+	for i, app := range apps {
+		resp.Apps[i] = toResponse(app)
+	}
+
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// Create registers an app from the form fields. Unset fields default like
+// they do for cmd/apps: open membership and a confidential client.
+func (h *handler) Create(w http.ResponseWriter, r *http.Request) {
+	app, err := appSettings(r, models.App{
+		OpenMembership: true,
+		ClientType:     models.ClientTypeConfidential,
+	})
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	app, err = h.apps.CreateApp(r.Context(), app)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, toResponse(app))
+}
+
+// Get returns the app given by the app_id parameter.
+func (h *handler) Get(w http.ResponseWriter, r *http.Request) {
+	appID, ok := formAppID(w, r)
+	if !ok {
+		return
+	}
+
+	app, err := h.apps.GetApp(r.Context(), appID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, toResponse(app))
+}
+
+// Update changes the settings given as form fields of the app given by
+// app_id. Settings missing from the form are kept.
+func (h *handler) Update(w http.ResponseWriter, r *http.Request) {
+	appID, ok := formAppID(w, r)
+	if !ok {
+		return
+	}
+
+	app, err := h.apps.GetApp(r.Context(), appID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	app, err = appSettings(r, app)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	app, err = h.apps.UpdateApp(r.Context(), app)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, toResponse(app))
+}
+
+// RotateSecret replaces the secret of the app given by app_id and returns
+// the new one.
+func (h *handler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	appID, ok := formAppID(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := h.apps.RotateAppSecret(r.Context(), appID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, secretResponse{Secret: secret})
+}
+
+// Delete deletes the app given by app_id.
+func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	appID, ok := formAppID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.apps.DeleteApp(r.Context(), appID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// permitted requires method and a caller holding apps:manage, and parses
+// the form before passing the request on to next.
+func (h *handler) permitted(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			response.MethodNotAllowed(w, method)
+			return
+		}
+
+		if _, ok := bearer.Permitted(w, r, h.log, h.authenticator, authz.PermAppsManage); !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			response.Error(w, http.StatusBadRequest, "malformed request body")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// appSettings applies the settings present in the form to app. List
+// settings are comma separated, token lifetimes are Go durations with 0
+// meaning the server default.
+func appSettings(r *http.Request, app models.App) (models.App, error) {
+	if r.Form.Has("name") {
+		app.Name = r.Form.Get("name")
+	}
+	if r.Form.Has("open_membership") {
+		open, err := strconv.ParseBool(r.Form.Get("open_membership"))
+		if err != nil {
+			return models.App{}, errors.New("open_membership must be true or false")
+		}
+		app.OpenMembership = open
+	}
+	if r.Form.Has("redirect_uris") {
+		app.RedirectURIs = splitList(r.Form.Get("redirect_uris"))
+	}
+	if r.Form.Has("client_type") {
+		app.ClientType = r.Form.Get("client_type")
+	}
+	if r.Form.Has("client_scopes") {
+		app.ClientScopes = splitList(r.Form.Get("client_scopes"))
+	}
+
+	for _, ttl := range []struct {
+		field string
+		value *time.Duration
+	}{
+		{"access_token_ttl", &app.AccessTokenTTL},
+		{"refresh_token_ttl", &app.RefreshTokenTTL},
+	} {
+		if !r.Form.Has(ttl.field) {
+			continue
+		}
+
+		d, err := time.ParseDuration(r.Form.Get(ttl.field))
+		if err != nil {
+			return models.App{}, fmt.Errorf("%s must be a duration", ttl.field)
+		}
+		*ttl.value = d
+	}
+
+	return app, nil
+}
+
+// formAppID returns the app_id form field or query parameter. On failure
+// the error response has been written and ok is false.
+func formAppID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	appID, err := strconv.Atoi(r.Form.Get("app_id"))
+	if err != nil || appID <= 0 {
+		response.Error(w, http.StatusBadRequest, "app_id is required")
+		return 0, false
+	}
+
+	return appID, true
+}
+
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, appsService.ErrAppNotFound):
+		response.Error(w, http.StatusNotFound, "app not found")
+	case errors.Is(err, appsService.ErrAppExists):
+		response.Error(w, http.StatusConflict, "app already exists")
+	case errors.Is(err, appsService.ErrInvalidClient):
+		// Drop the op prefix, leaving the setting that was rejected.
+		msg := err.Error()
+		response.Error(w, http.StatusBadRequest, msg[strings.Index(msg, appsService.ErrInvalidClient.Error()):])
+	default:
+		h.log.Error("apps request failed", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func toResponse(app models.App) appResponse {
+	resp := appResponse{
+		ID:             app.ID,
+		Name:           app.Name,
+		Secret:         app.Secret,
+		OpenMembership: app.OpenMembership,
+		RedirectURIs:   app.RedirectURIs,
+		ClientType:     app.ClientType,
+		ClientScopes:   app.ClientScopes,
+	}
+	if app.AccessTokenTTL > 0 {
+		resp.AccessTokenTTL = app.AccessTokenTTL.String()
+	}
+	if app.RefreshTokenTTL > 0 {
+		resp.RefreshTokenTTL = app.RefreshTokenTTL.String()
+	}
+
+	return resp
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
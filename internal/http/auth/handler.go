@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sso/internal/http/response"
+	authService "sso/internal/services/auth"
+)
+
+type Auth interface {
+	JWKS(ctx context.Context) (authService.JWKS, error)
+}
+
+type handler struct {
+	auth Auth
+}
+
+func Register(mux *http.ServeMux, auth Auth) {
+	h := &handler{auth: auth}
+
+	mux.HandleFunc("/.well-known/jwks.json", h.JWKS)
+}
+
+func (h *handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.MethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	jwks, err := h.auth.JWKS(r.Context())
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to load keys")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	response.JSON(w, http.StatusOK, jwks)
+}
@@ -0,0 +1,99 @@
+// Package bearer authenticates HTTP requests with the access tokens issued
+// by Login.
+package bearer
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sso/internal/authz"
+	"sso/internal/http/response"
+	"sso/internal/sl"
+	"strings"
+)
+
+type Authenticator interface {
+	IsAuthenticated(ctx context.Context, token string) (bool, int64, error)
+}
+
+type PrincipalAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (authz.Principal, bool, error)
+}
+
+// Token returns the bearer token of the Authorization header.
+func Token(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+// UserID authenticates the request and returns the id of the user. Service
+// principals are rejected since they act for no user. On failure the error
+// response has been written and ok is false.
+func UserID(w http.ResponseWriter, r *http.Request, log *slog.Logger, authenticator Authenticator) (int64, bool) {
+	token, ok := Token(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+		response.Error(w, http.StatusUnauthorized, "missing bearer token")
+		return 0, false
+	}
+
+	isAuthenticated, userID, err := authenticator.IsAuthenticated(r.Context(), token)
+	if err != nil {
+		log.Error("failed to authenticate request", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return 0, false
+	}
+	if !isAuthenticated || userID == 0 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+		response.Error(w, http.StatusUnauthorized, "invalid token")
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// Permitted authenticates the request and checks that the caller holds
+// permission, either as a user or as a service granted it as a scope. On
+// failure the error response has been written and ok is false.
+func Permitted(
+	w http.ResponseWriter,
+	r *http.Request,
+	log *slog.Logger,
+	authenticator PrincipalAuthenticator,
+	permission string,
+) (authz.Principal, bool) {
+	token, ok := Token(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+		response.Error(w, http.StatusUnauthorized, "missing bearer token")
+		return authz.Principal{}, false
+	}
+
+	principal, ok, err := authenticator.Authenticate(r.Context(), token)
+	if err != nil {
+		log.Error("failed to authenticate request", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return authz.Principal{}, false
+	}
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+		response.Error(w, http.StatusUnauthorized, "invalid token")
+		return authz.Principal{}, false
+	}
+
+	if !principal.HasPermission(permission) {
+		log.Warn("permission denied",
+			slog.String("path", r.URL.Path),
+			slog.Int64("user_id", principal.UserID),
+			slog.Int("client_id", principal.ClientID),
+		)
+		response.Error(w, http.StatusForbidden, "permission denied")
+		return authz.Principal{}, false
+	}
+
+	return principal, true
+}
@@ -0,0 +1,175 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"sso/internal/domain/models"
+	"sso/internal/http/bearer"
+	"sso/internal/http/response"
+	"sso/internal/lockout"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+	"strconv"
+)
+
+type MFA interface {
+	IsAuthenticated(ctx context.Context, token string) (bool, int64, error)
+	EnrollTOTP(ctx context.Context, userID int64) (secret string, uri string, err error)
+	ConfirmTOTP(ctx context.Context, userID int64, code string) (recoveryCodes []string, err error)
+	DisableTOTP(ctx context.Context, userID int64, code string) error
+	VerifyMFA(ctx context.Context, mfaToken string, code string, appID int) (models.TokenPair, error)
+}
+
+type handler struct {
+	log *slog.Logger
+	mfa MFA
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, mfa MFA) {
+	h := &handler{log: log, mfa: mfa}
+
+	mux.HandleFunc("/mfa/totp/enroll", h.authenticated(h.Enroll))
+	mux.HandleFunc("/mfa/totp/confirm", h.authenticated(h.Confirm))
+	mux.HandleFunc("/mfa/totp/disable", h.authenticated(h.Disable))
+	mux.HandleFunc("/mfa/verify", h.Verify)
+}
+
+type enrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// Enroll starts TOTP enrollment for the caller.
+func (h *handler) Enroll(w http.ResponseWriter, r *http.Request, userID int64) {
+	secret, uri, err := h.mfa.EnrollTOTP(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, enrollResponse{Secret: secret, URI: uri})
+}
+
+type confirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Confirm enables two-factor authentication with the first code from the
+// authenticator app.
+func (h *handler) Confirm(w http.ResponseWriter, r *http.Request, userID int64) {
+	codes, err := h.mfa.ConfirmTOTP(r.Context(), userID, r.PostForm.Get("code"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, confirmResponse{RecoveryCodes: codes})
+}
+
+// Disable turns two-factor authentication off.
+func (h *handler) Disable(w http.ResponseWriter, r *http.Request, userID int64) {
+	if err := h.mfa.DisableTOTP(r.Context(), userID, r.PostForm.Get("code")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type verifyResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Verify is the second login step: it exchanges the MFA token returned by
+// Login and a TOTP or recovery code for access tokens.
+func (h *handler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		response.Error(w, http.StatusBadRequest, "malformed request body")
+		return
+	}
+
+	appID, err := strconv.Atoi(r.PostForm.Get("app_id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "app_id is required")
+		return
+	}
+
+	tokens, err := h.mfa.VerifyMFA(r.Context(), r.PostForm.Get("mfa_token"), r.PostForm.Get("code"), appID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, verifyResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+// authenticated requires a POST with the bearer access token of a user and
+// passes the user id on to next.
+func (h *handler) authenticated(next func(http.ResponseWriter, *http.Request, int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			response.MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		userID, ok := bearer.UserID(w, r, h.log, h.mfa)
+		if !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			response.Error(w, http.StatusBadRequest, "malformed request body")
+			return
+		}
+
+		next(w, r, userID)
+	}
+}
+
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authService.ErrInvalidMFACode):
+		response.Error(w, http.StatusUnauthorized, "invalid code")
+	case errors.Is(err, authService.ErrInvalidMFAToken):
+		response.Error(w, http.StatusUnauthorized, "invalid or expired mfa token")
+	case errors.Is(err, authService.ErrMFAAlreadyEnabled):
+		response.Error(w, http.StatusConflict, "two-factor authentication is already enabled")
+	case errors.Is(err, authService.ErrMFANotEnrolled):
+		response.Error(w, http.StatusConflict, "two-factor authentication is not enrolled")
+	case errors.Is(err, authService.ErrNotAppMember):
+		response.Error(w, http.StatusForbidden, "user is not a member of the app")
+	case errors.Is(err, authService.ErrMFADisabled):
+		response.Error(w, http.StatusNotFound, "two-factor authentication is not enabled")
+	case errors.Is(err, authService.ErrAccountLocked):
+		setRetryAfter(w, err)
+		response.Error(w, http.StatusForbidden, "account is temporarily locked")
+	case errors.Is(err, authService.ErrTooManyAttempts):
+		setRetryAfter(w, err)
+		response.Error(w, http.StatusTooManyRequests, "too many failed attempts")
+	default:
+		h.log.Error("mfa request failed", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// setRetryAfter tells the client when the lockout behind err ends.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter(err).Seconds()))))
+}
@@ -0,0 +1,49 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// csrfCookie holds the CSRF token of the authorize forms. Every form
+// carries the same token in its csrf_token field, which a cross-site
+// request cannot read from the cookie to copy.
+const csrfCookie = "sso_csrf"
+
+// csrfToken returns the CSRF token of the browser, setting a new cookie
+// when it has none yet.
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/authorize",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return token, nil
+}
+
+// validCSRFToken reports whether the csrf_token form field matches the
+// CSRF cookie.
+func validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get("csrf_token"))) == 1
+}
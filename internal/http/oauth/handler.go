@@ -0,0 +1,492 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sso/internal/domain/models"
+	"sso/internal/http/response"
+	"sso/internal/lockout"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+	"strconv"
+	"strings"
+)
+
+type OAuth interface {
+	ValidateAuthorizeRequest(ctx context.Context, req authService.AuthorizeRequest) (models.App, error)
+	Authorize(
+		ctx context.Context,
+		req authService.AuthorizeRequest,
+		email string,
+		password string,
+		mfaCode string,
+	) (code string, consentToken string, err error)
+	Consent(ctx context.Context, req authService.AuthorizeRequest, consentToken string, allow bool) (code string, err error)
+	ExchangeCode(
+		ctx context.Context,
+		clientID int,
+		clientSecret string,
+		code string,
+		redirectURI string,
+		codeVerifier string,
+	) (tokens models.TokenPair, scope string, err error)
+	RefreshClient(ctx context.Context, clientID int, clientSecret string, refreshToken string) (models.TokenPair, error)
+	ClientCredentials(
+		ctx context.Context,
+		clientID int,
+		clientSecret string,
+		scope string,
+	) (tokens models.TokenPair, granted string, err error)
+	IntrospectToken(
+		ctx context.Context,
+		clientID int,
+		clientSecret string,
+		token string,
+		hint string,
+	) (authService.Introspection, error)
+	RevokeToken(ctx context.Context, clientID int, clientSecret string, token string, hint string) error
+}
+
+type handler struct {
+	log   *slog.Logger
+	oauth OAuth
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, oauth OAuth) {
+	h := &handler{log: log, oauth: oauth}
+
+	mux.HandleFunc("/authorize", h.Authorize)
+	mux.HandleFunc("/token", h.Token)
+	mux.HandleFunc("/introspect", h.Introspect)
+	mux.HandleFunc("/revoke", h.Revoke)
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.App.Name}}</title></head>
+<body>
+{{if .ConsentToken}}<h1>Allow {{.App.Name}} access?</h1>{{else}}<h1>Sign in to {{.App.Name}}</h1>{{end}}
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.App.ID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+{{if .ConsentToken}}<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+{{if .Scopes}}<p>{{.App.Name}} asks for access to:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{else}}<p>{{.App.Name}} asks to sign you in.</p>{{end}}
+<p>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</p>
+{{else}}<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+<p><label>Password <input type="password" name="password" required></label></p>
+<p><label>Authentication code <input type="text" name="mfa_code" autocomplete="one-time-code"></label>
+<small>only if two-factor authentication is enabled</small></p>
+<p>
+<button type="submit" name="decision" value="sign-in">Sign in</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Cancel</button>
+</p>
+{{end}}</form>
+</body>
+</html>
+`))
+
+type authorizePageData struct {
+	App          models.App
+	Request      authService.AuthorizeRequest
+	Scopes       []string
+	Email        string
+	Error        string
+	CSRFToken    string
+	ConsentToken string
+}
+
+// Authorize serves the authorization code flow. GET renders the login page;
+// its submission authenticates the user and, unless they consented to the
+// requested scope before, renders the consent page, whose submission
+// records the decision of the user. Both forms are bound to the CSRF cookie.
+func (h *handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost && !validCSRFToken(r) {
+		h.log.Warn("authorize form submitted without a valid csrf token")
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+
+	clientID, err := strconv.Atoi(r.Form.Get("client_id"))
+	if err != nil {
+		http.Error(w, "invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	req := authService.AuthorizeRequest{
+		ClientID:            clientID,
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		Nonce:               r.Form.Get("nonce"),
+	}
+
+	app, err := h.oauth.ValidateAuthorizeRequest(r.Context(), req)
+	switch {
+	case errors.Is(err, authService.ErrInvalidClient):
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case errors.Is(err, authService.ErrInvalidRedirectURI):
+		// Never redirect to an unregistered URI.
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	case errors.Is(err, authService.ErrInvalidRequest):
+		redirectError(w, r, req, "invalid_request")
+		return
+	case err != nil:
+		h.log.Error("failed to validate authorize request", sl.Err(err))
+		redirectError(w, r, req, "server_error")
+		return
+	}
+
+	if r.Form.Get("response_type") != "code" {
+		redirectError(w, r, req, "unsupported_response_type")
+		return
+	}
+
+	page := authorizePageData{App: app, Request: req, Scopes: strings.Fields(req.Scope)}
+
+	page.CSRFToken, err = csrfToken(w, r)
+	if err != nil {
+		h.log.Error("failed to generate csrf token", sl.Err(err))
+		redirectError(w, r, req, "server_error")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet:
+		h.renderAuthorize(w, http.StatusOK, page)
+	case r.PostForm.Has("consent_token"):
+		h.consent(w, r, page)
+	case r.PostForm.Get("decision") == "deny":
+		redirectError(w, r, req, "access_denied")
+	default:
+		h.signIn(w, r, page)
+	}
+}
+
+// signIn handles the login form. It redirects with an authorization code
+// or renders the consent page.
+func (h *handler) signIn(w http.ResponseWriter, r *http.Request, page authorizePageData) {
+	req := page.Request
+	email := r.PostForm.Get("email")
+	page.Email = email
+
+	code, consentToken, err := h.oauth.Authorize(r.Context(), req, email, r.PostForm.Get("password"), r.PostForm.Get("mfa_code"))
+	switch {
+	case errors.Is(err, authService.ErrMFARequired):
+		page.Error = "Enter the code from your authenticator app."
+		h.renderAuthorize(w, http.StatusUnauthorized, page)
+		return
+	case errors.Is(err, authService.ErrInvalidMFACode):
+		page.Error = "Invalid authentication code."
+		h.renderAuthorize(w, http.StatusUnauthorized, page)
+		return
+	case errors.Is(err, authService.ErrInvalidCredentials):
+		page.Error = "Invalid email or password."
+		h.renderAuthorize(w, http.StatusUnauthorized, page)
+		return
+	case errors.Is(err, authService.ErrAccountLocked):
+		page.Error = "Too many failed attempts. Your account is temporarily locked."
+		h.renderAuthorize(w, http.StatusForbidden, page)
+		return
+	case errors.Is(err, authService.ErrTooManyAttempts):
+		page.Error = "Too many failed attempts. Try again later."
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter(err).Seconds()))))
+		h.renderAuthorize(w, http.StatusTooManyRequests, page)
+		return
+	case errors.Is(err, authService.ErrUserNotActivated):
+		page.Error = "Your account is not activated yet."
+		h.renderAuthorize(w, http.StatusForbidden, page)
+		return
+	case errors.Is(err, authService.ErrNotAppMember):
+		redirectError(w, r, req, "access_denied")
+		return
+	case err != nil:
+		h.log.Error("failed to authorize", sl.Err(err))
+		redirectError(w, r, req, "server_error")
+		return
+	}
+
+	if consentToken != "" {
+		page.ConsentToken = consentToken
+		h.renderAuthorize(w, http.StatusOK, page)
+		return
+	}
+
+	redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// consent handles the consent form, passing on the decision of the user.
+func (h *handler) consent(w http.ResponseWriter, r *http.Request, page authorizePageData) {
+	req := page.Request
+	allow := r.PostForm.Get("decision") == "allow"
+
+	code, err := h.oauth.Consent(r.Context(), req, r.PostForm.Get("consent_token"), allow)
+	switch {
+	case errors.Is(err, authService.ErrAccessDenied):
+		redirectError(w, r, req, "access_denied")
+		return
+	case errors.Is(err, authService.ErrInvalidConsentToken):
+		page.Error = "Your sign-in has expired. Sign in again."
+		h.renderAuthorize(w, http.StatusUnauthorized, page)
+		return
+	case err != nil:
+		h.log.Error("failed to record consent", sl.Err(err))
+		redirectError(w, r, req, "server_error")
+		return
+	}
+
+	redirect(w, r, req, url.Values{"code": {code}})
+}
+
+func (h *handler) renderAuthorize(w http.ResponseWriter, status int, data authorizePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	if err := authorizePage.Execute(w, data); err != nil {
+		h.log.Error("failed to render authorize page", sl.Err(err))
+	}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// Token is the token endpoint. It supports the authorization_code,
+// refresh_token and client_credentials grants.
+func (h *handler) Token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return
+	}
+
+	clientID, clientSecret, ok := clientCredentials(r)
+	if !ok {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	var (
+		tokens models.TokenPair
+		scope  string
+		err    error
+	)
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		tokens, scope, err = h.oauth.ExchangeCode(
+			r.Context(),
+			clientID,
+			clientSecret,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case "refresh_token":
+		tokens, err = h.oauth.RefreshClient(r.Context(), clientID, clientSecret, r.PostForm.Get("refresh_token"))
+	case "client_credentials":
+		tokens, scope, err = h.oauth.ClientCredentials(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	case "":
+		tokenError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	if err != nil {
+		h.writeTokenError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        scope,
+		IDToken:      tokens.IDToken,
+	})
+}
+
+// Introspect is the RFC 7662 token introspection endpoint.
+func (h *handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	clientID, clientSecret, token, ok := h.tokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := h.oauth.IntrospectToken(r.Context(), clientID, clientSecret, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		h.writeTokenError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, info)
+}
+
+// Revoke is the RFC 7009 token revocation endpoint. Unknown tokens are
+// reported as revoked.
+func (h *handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	clientID, clientSecret, token, ok := h.tokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.oauth.RevokeToken(r.Context(), clientID, clientSecret, token, r.PostForm.Get("token_type_hint")); err != nil {
+		h.writeTokenError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// tokenRequest reads the client credentials and the token parameter shared
+// by the introspection and revocation endpoints.
+func (h *handler) tokenRequest(w http.ResponseWriter, r *http.Request) (int, string, string, bool) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return 0, "", "", false
+	}
+
+	clientID, clientSecret, ok := clientCredentials(r)
+	if !ok {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return 0, "", "", false
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return 0, "", "", false
+	}
+
+	return clientID, clientSecret, token, true
+}
+
+func (h *handler) writeTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authService.ErrInvalidClient):
+		w.Header().Set("WWW-Authenticate", `Basic realm="sso"`)
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	case errors.Is(err, authService.ErrInvalidGrant),
+		errors.Is(err, authService.ErrNotAppMember):
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "")
+	case errors.Is(err, authService.ErrUnauthorizedClient):
+		tokenError(w, http.StatusBadRequest, "unauthorized_client", "client is not allowed to use this grant")
+	case errors.Is(err, authService.ErrInvalidScope):
+		tokenError(w, http.StatusBadRequest, "invalid_scope", "")
+	default:
+		h.log.Error("failed to issue token", sl.Err(err))
+		tokenError(w, http.StatusInternalServerError, "server_error", "")
+	}
+}
+
+func tokenError(w http.ResponseWriter, status int, code string, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+
+	response.JSON(w, status, body)
+}
+
+// clientCredentials reads the client id and secret from HTTP basic auth or
+// from the request body.
+func clientCredentials(r *http.Request) (int, string, bool) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return clientID, secret, true
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req authService.AuthorizeRequest, code string) {
+	redirect(w, r, req, url.Values{"error": {code}})
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, req authService.AuthorizeRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	query := target.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
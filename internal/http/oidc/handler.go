@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	ssov1 "github.com/DarkhanOmirbay/proto/proto/gen/go/sso"
+	"log/slog"
+	"net/http"
+	"sso/internal/domain/models"
+	"sso/internal/http/bearer"
+	"sso/internal/http/response"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+	"strings"
+)
+
+type OIDC interface {
+	Issuer() string
+	SigningAlgorithm() string
+	UserInfoClaims(ctx context.Context, token string) (*authService.TokenClaims, error)
+}
+
+// Profiles is the user service, which owns the profile userinfo reports.
+type Profiles interface {
+	ShowProfile(ctx context.Context, userID int64) (*ssov1.User, error)
+}
+
+type handler struct {
+	log      *slog.Logger
+	oidc     OIDC
+	profiles Profiles
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, oidc OIDC, profiles Profiles) {
+	h := &handler{log: log, oidc: oidc, profiles: profiles}
+
+	mux.HandleFunc("/.well-known/openid-configuration", h.Discovery)
+	mux.HandleFunc("/userinfo", h.UserInfo)
+}
+
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Discovery serves the OpenID Provider metadata.
+func (h *handler) Discovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.MethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	issuer := strings.TrimSuffix(h.oidc.Issuer(), "/")
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	response.JSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            issuer + "/authorize",
+		TokenEndpoint:                    issuer + "/token",
+		UserInfoEndpoint:                 issuer + "/userinfo",
+		IntrospectionEndpoint:            issuer + "/introspect",
+		RevocationEndpoint:               issuer + "/revoke",
+		JWKSURI:                          issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:           []string{"code"},
+		GrantTypesSupported:              []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{h.oidc.SigningAlgorithm()},
+		ScopesSupported: []string{
+			authService.ScopeOpenID,
+			authService.ScopeEmail,
+			authService.ScopeProfile,
+		},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce",
+			"email", "email_verified", "given_name", "family_name",
+		},
+	})
+}
+
+// UserInfo returns the claims of the user the bearer access token was
+// issued to that its scope grants. The profile comes from the user service,
+// which does not report whether the email was verified, so email_verified is
+// only part of ID tokens.
+func (h *handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	token, ok := bearer.Token(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+		response.Error(w, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+
+	claims, err := h.oidc.UserInfoClaims(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, authService.ErrInvalidToken) {
+			h.invalidToken(w)
+			return
+		}
+
+		h.log.Error("failed to authenticate userinfo request", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	userID := int64(claims.UID)
+	profile, err := h.profiles.ShowProfile(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.invalidToken(w)
+			return
+		}
+
+		h.log.Error("failed to load user info", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	info := authService.NewUserInfo(models.User{
+		ID:    userID,
+		Fname: profile.Fname,
+		Lname: profile.Lname,
+		Email: profile.Email,
+	}, claims.Scope)
+	info.EmailVerified = nil
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, info)
+}
+
+func (h *handler) invalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+	response.Error(w, http.StatusUnauthorized, "invalid token")
+}
@@ -0,0 +1,128 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sso/internal/domain/storage/memory"
+	"sso/internal/http/oidc"
+	"sso/internal/password"
+	"sso/internal/services/auth"
+	"sso/internal/services/user"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery staple"
+
+// newServer serves the OpenID Connect endpoints of an Auth with an EdDSA
+// key over an in-memory storage, and returns the access token of a logged
+// in user.
+func newServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	storage, err := memory.Open("memory://?app=test:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := auth.New(log, time.Hour, 24*time.Hour, auth.NewKeySet(key), storage,
+		auth.WithPasswordHasher(password.Bcrypt{Cost: 4}),
+		auth.WithOAuth(time.Minute, "https://sso.test"),
+	)
+
+	ctx := context.Background()
+	if _, err := a.RegisterNewUser(ctx, "Ada", "Lovelace", "ada@example.com", testPassword); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	pair, err := a.Login(ctx, "ada@example.com", testPassword, 1)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	oidc.Register(mux, log, a, user.New(log, storage, time.Hour, nil, nil, nil))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, pair.AccessToken
+}
+
+func getJSON(t *testing.T, srv *httptest.Server, path, token string, v any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+func TestDiscoveryAdvertisesSigningAlgorithm(t *testing.T) {
+	srv, _ := newServer(t)
+
+	var doc struct {
+		Algorithms []string `json:"id_token_signing_alg_values_supported"`
+	}
+	if status := getJSON(t, srv, "/.well-known/openid-configuration", "", &doc); status != http.StatusOK {
+		t.Fatalf("status %d, want %d", status, http.StatusOK)
+	}
+
+	if len(doc.Algorithms) != 1 || doc.Algorithms[0] != auth.AlgEdDSA {
+		t.Errorf("advertised algorithms %v, want [%s]", doc.Algorithms, auth.AlgEdDSA)
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	srv, token := newServer(t)
+
+	var info map[string]any
+	if status := getJSON(t, srv, "/userinfo", token, &info); status != http.StatusOK {
+		t.Fatalf("status %d, want %d", status, http.StatusOK)
+	}
+
+	want := map[string]any{
+		"sub":         "1",
+		"email":       "ada@example.com",
+		"given_name":  "Ada",
+		"family_name": "Lovelace",
+	}
+	if len(info) != len(want) {
+		t.Errorf("claims %v, want %v", info, want)
+	}
+	for claim, value := range want {
+		if info[claim] != value {
+			t.Errorf("%s = %v, want %v", claim, info[claim], value)
+		}
+	}
+
+	if status := getJSON(t, srv, "/userinfo", "bogus", &info); status != http.StatusUnauthorized {
+		t.Errorf("invalid token: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,172 @@
+// Package passkey serves the WebAuthn registration and login ceremonies.
+// Begin endpoints return the options for the browser WebAuthn API and a
+// session id; finish endpoints take the session id in the query string and
+// the credential JSON produced by the browser as the body.
+package passkey
+
+import (
+	"context"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"io"
+	"log/slog"
+	"net/http"
+	"sso/internal/domain/models"
+	"sso/internal/http/bearer"
+	"sso/internal/http/response"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+	"strconv"
+)
+
+const maxBodySize = 64 << 10
+
+type Passkeys interface {
+	IsAuthenticated(ctx context.Context, token string) (bool, int64, error)
+	BeginWebAuthnRegistration(ctx context.Context, userID int64) (string, *protocol.CredentialCreation, error)
+	FinishWebAuthnRegistration(ctx context.Context, userID int64, sessionID string, response io.Reader) error
+	BeginWebAuthnLogin(ctx context.Context, email string) (string, *protocol.CredentialAssertion, error)
+	FinishWebAuthnLogin(ctx context.Context, sessionID string, appID int, response io.Reader) (models.TokenPair, error)
+}
+
+type handler struct {
+	log      *slog.Logger
+	passkeys Passkeys
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, passkeys Passkeys) {
+	h := &handler{log: log, passkeys: passkeys}
+
+	mux.HandleFunc("/webauthn/register/begin", h.BeginRegistration)
+	mux.HandleFunc("/webauthn/register/finish", h.FinishRegistration)
+	mux.HandleFunc("/webauthn/login/begin", h.BeginLogin)
+	mux.HandleFunc("/webauthn/login/finish", h.FinishLogin)
+}
+
+type beginResponse struct {
+	SessionID string `json:"session_id"`
+	Options   any    `json:"options"`
+}
+
+// BeginRegistration starts registering a passkey for the caller.
+func (h *handler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	userID, ok := bearer.UserID(w, r, h.log, h.passkeys)
+	if !ok {
+		return
+	}
+
+	sessionID, options, err := h.passkeys.BeginWebAuthnRegistration(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, beginResponse{SessionID: sessionID, Options: options})
+}
+
+// FinishRegistration stores the passkey created by the authenticator.
+func (h *handler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	userID, ok := bearer.UserID(w, r, h.log, h.passkeys)
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBodySize)
+	err := h.passkeys.FinishWebAuthnRegistration(r.Context(), userID, r.URL.Query().Get("session_id"), body)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginLogin starts a passkey login. The optional email form value limits
+// the login to the passkeys of that user.
+func (h *handler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		response.Error(w, http.StatusBadRequest, "malformed request body")
+		return
+	}
+
+	sessionID, options, err := h.passkeys.BeginWebAuthnLogin(r.Context(), r.Form.Get("email"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, beginResponse{SessionID: sessionID, Options: options})
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// FinishLogin verifies the assertion and issues tokens for the app_id
+// query parameter.
+func (h *handler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	query := r.URL.Query()
+
+	appID, err := strconv.Atoi(query.Get("app_id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "app_id is required")
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBodySize)
+	tokens, err := h.passkeys.FinishWebAuthnLogin(r.Context(), query.Get("session_id"), appID, body)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authService.ErrWebAuthnDisabled):
+		response.Error(w, http.StatusNotFound, "passkeys are not enabled")
+	case errors.Is(err, authService.ErrInvalidWebAuthnSession):
+		response.Error(w, http.StatusBadRequest, "invalid or expired session")
+	case errors.Is(err, authService.ErrInvalidCredential),
+		errors.Is(err, authService.ErrInvalidCredentials):
+		response.Error(w, http.StatusUnauthorized, "invalid credential")
+	case errors.Is(err, authService.ErrUserNotActivated):
+		response.Error(w, http.StatusForbidden, "account is not activated")
+	case errors.Is(err, authService.ErrNotAppMember):
+		response.Error(w, http.StatusForbidden, "user is not a member of the app")
+	default:
+		h.log.Error("passkey request failed", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+	}
+}
@@ -0,0 +1,223 @@
+// Package session lets users see where they are logged in and end single
+// sessions or all of them. Every endpoint but /refresh takes the bearer
+// access token of the user; /refresh takes a refresh token instead.
+package session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sso/internal/domain/models"
+	"sso/internal/http/bearer"
+	"sso/internal/http/response"
+	authService "sso/internal/services/auth"
+	"sso/internal/sl"
+	"strconv"
+	"time"
+)
+
+type Sessions interface {
+	IsAuthenticated(ctx context.Context, token string) (bool, int64, error)
+	ListSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	Logout(ctx context.Context, token string) error
+	LogoutAll(ctx context.Context, token string) error
+	Refresh(ctx context.Context, refreshToken string, appID int) (models.TokenPair, error)
+}
+
+type handler struct {
+	log      *slog.Logger
+	sessions Sessions
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, sessions Sessions) {
+	h := &handler{log: log, sessions: sessions}
+
+	mux.HandleFunc("/sessions", h.List)
+	mux.HandleFunc("/sessions/revoke", h.Revoke)
+	mux.HandleFunc("/sessions/revoke-all", h.RevokeAll)
+	mux.HandleFunc("/logout", h.Logout)
+	mux.HandleFunc("/refresh", h.Refresh)
+}
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	AppID      int       `json:"app_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type listResponse struct {
+	Sessions []sessionResponse `json:"sessions"`
+}
+
+// List returns the active sessions of the caller.
+func (h *handler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		response.MethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	userID, ok := bearer.UserID(w, r, h.log, h.sessions)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessions.ListSessions(r.Context(), userID)
+	if err != nil {
+		h.log.Error("failed to list sessions", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := listResponse{Sessions: make([]sessionResponse, len(sessions))}
+	for i, s := range sessions {
+		resp.Sessions[i] = sessionResponse{
+			ID:         s.ID,
+			AppID:      s.AppID,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.Expiry,
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// Revoke ends the session given by the session_id form field.
+func (h *handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	userID, ok := bearer.UserID(w, r, h.log, h.sessions)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		response.Error(w, http.StatusBadRequest, "malformed request body")
+		return
+	}
+
+	sessionID := r.PostForm.Get("session_id")
+	if sessionID == "" {
+		response.Error(w, http.StatusBadRequest, "session_id is required")
+		return
+	}
+
+	err := h.sessions.RevokeSession(r.Context(), userID, sessionID)
+	switch {
+	case errors.Is(err, authService.ErrSessionNotFound):
+		response.Error(w, http.StatusNotFound, "session not found")
+		return
+	case err != nil:
+		h.log.Error("failed to revoke session", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAll logs the caller out of every session.
+func (h *handler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, h.sessions.LogoutAll)
+}
+
+// Logout ends the session of the presented token.
+func (h *handler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, h.sessions.Logout)
+}
+
+func (h *handler) logout(w http.ResponseWriter, r *http.Request, logout func(ctx context.Context, token string) error) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	token, ok := bearer.Token(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+		response.Error(w, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+
+	err := logout(r.Context(), token)
+	switch {
+	case errors.Is(err, authService.ErrInvalidToken):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+		response.Error(w, http.StatusUnauthorized, "invalid token")
+		return
+	case err != nil:
+		h.log.Error("failed to log out", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Refresh exchanges the refresh_token form field for new tokens of the app
+// given by app_id. It serves the refresh tokens of Login and of passkey
+// logins, whose apps need not authenticate as OAuth clients to use them.
+func (h *handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		response.Error(w, http.StatusBadRequest, "malformed request body")
+		return
+	}
+
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		response.Error(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	appID, err := strconv.Atoi(r.PostForm.Get("app_id"))
+	if err != nil || appID <= 0 {
+		response.Error(w, http.StatusBadRequest, "app_id is required")
+		return
+	}
+
+	tokens, err := h.sessions.Refresh(r.Context(), refreshToken, appID)
+	switch {
+	case errors.Is(err, authService.ErrInvalidRefreshToken), errors.Is(err, authService.ErrRefreshTokenReused):
+		response.Error(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	case errors.Is(err, authService.ErrNotAppMember):
+		response.Error(w, http.StatusForbidden, "not a member of the app")
+		return
+	case err != nil:
+		h.log.Error("failed to refresh tokens", sl.Err(err))
+		response.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	})
+}
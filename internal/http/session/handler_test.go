@@ -0,0 +1,150 @@
+package session_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage/memory"
+	"sso/internal/http/session"
+	"sso/internal/password"
+	"sso/internal/services/auth"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery staple"
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newServer serves the session endpoints of an Auth over an in-memory
+// storage with a single app, and returns the tokens of a logged in user of
+// that app.
+func newServer(t *testing.T) (*httptest.Server, *auth.Auth, models.TokenPair) {
+	t.Helper()
+
+	storage, err := memory.Open("memory://?app=test:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := auth.New(log, time.Hour, 24*time.Hour, auth.NewKeySet(key), storage,
+		auth.WithPasswordHasher(password.Bcrypt{Cost: 4}),
+	)
+
+	ctx := context.Background()
+	if _, err := a.RegisterNewUser(ctx, "Test", "User", "user@example.com", testPassword); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	pair, err := a.Login(ctx, "user@example.com", testPassword, 1)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	session.Register(mux, log, a)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, a, pair
+}
+
+func refresh(t *testing.T, srv *httptest.Server, refreshToken string, appID int) (*http.Response, tokenResponse) {
+	t.Helper()
+
+	form := url.Values{"refresh_token": {refreshToken}, "app_id": {strconv.Itoa(appID)}}
+	resp, err := http.PostForm(srv.URL+"/refresh", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var tokens tokenResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp, tokens
+}
+
+func TestRefresh(t *testing.T) {
+	srv, a, pair := newServer(t)
+
+	resp, tokens := refresh(t, srv, pair.RefreshToken, 1)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("tokens may be cached")
+	}
+	if tokens.RefreshToken == "" || tokens.RefreshToken == pair.RefreshToken {
+		t.Errorf("refresh token was not rotated")
+	}
+
+	ok, _, err := a.IsAuthenticated(context.Background(), tokens.AccessToken)
+	if err != nil || !ok {
+		t.Errorf("refreshed access token not accepted: %t, %v", ok, err)
+	}
+
+	// The rotated token can be used once more; the old one cannot.
+	if resp, _ := refresh(t, srv, tokens.RefreshToken, 1); resp.StatusCode != http.StatusOK {
+		t.Errorf("rotated token: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp, _ := refresh(t, srv, pair.RefreshToken, 1); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("reused token: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshRejectsInvalidRequests(t *testing.T) {
+	srv, _, pair := newServer(t)
+
+	for _, tt := range []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{name: "no refresh token", form: url.Values{"app_id": {"1"}}, status: http.StatusBadRequest},
+		{name: "no app", form: url.Values{"refresh_token": {pair.RefreshToken}}, status: http.StatusBadRequest},
+		{name: "unknown token", form: url.Values{"refresh_token": {"bogus"}, "app_id": {"1"}}, status: http.StatusUnauthorized},
+		{name: "other app", form: url.Values{"refresh_token": {pair.RefreshToken}, "app_id": {"2"}}, status: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(srv.URL+"/refresh", "application/x-www-form-urlencoded", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,167 @@
+// Package lockout throttles password guessing. Every failed login delays the
+// next attempt for the account exponentially, the account is locked after
+// too many failures, and client addresses producing many failures across
+// accounts are blocked as well.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"sso/internal/domain/models"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLocked          = errors.New("account is temporarily locked")
+	ErrTooManyAttempts = errors.New("too many failed login attempts")
+)
+
+// Error carries the time after which the refused attempt may be retried.
+type Error struct {
+	err        error
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter returns how long the caller has to wait after err, or zero
+// when err does not come from the limiter.
+func RetryAfter(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// Store keeps the failure counters. RecordFailure restarts the count when
+// the previous failure is older than window.
+type Store interface {
+	LoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// MaxFailures is the number of failures after which the account is
+	// locked for LockDuration.
+	MaxFailures  int
+	LockDuration time.Duration
+	// BaseDelay is the delay after the first failure. It doubles with every
+	// further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered.
+	Window time.Duration
+	// IPMaxFailures is the number of failures from one address, across all
+	// accounts, after which the address is blocked for LockDuration.
+	IPMaxFailures int
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Check refuses the attempt while the account or the address is blocked.
+// A locked account is reported with ErrLocked, everything else with
+// ErrTooManyAttempts.
+func (l *Limiter) Check(ctx context.Context, account string, ip string) error {
+	now := l.now()
+
+	attempts, err := l.store.LoginAttempts(ctx, accountKey(account))
+	if err != nil {
+		return err
+	}
+	if now.Before(attempts.BlockedUntil) {
+		reason := ErrTooManyAttempts
+		if attempts.Failures >= l.policy.MaxFailures {
+			reason = ErrLocked
+		}
+		return &Error{err: reason, RetryAfter: attempts.BlockedUntil.Sub(now)}
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	attempts, err = l.store.LoginAttempts(ctx, ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if now.Before(attempts.BlockedUntil) {
+		return &Error{err: ErrTooManyAttempts, RetryAfter: attempts.BlockedUntil.Sub(now)}
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt and blocks the account, and possibly the
+// address, accordingly.
+func (l *Limiter) Fail(ctx context.Context, account string, ip string) error {
+	now := l.now()
+
+	failures, err := l.store.RecordLoginFailure(ctx, accountKey(account), l.policy.Window)
+	if err != nil {
+		return err
+	}
+
+	until := now.Add(l.delay(failures))
+	if failures >= l.policy.MaxFailures {
+		until = now.Add(l.policy.LockDuration)
+	}
+	if err := l.store.BlockLogin(ctx, accountKey(account), until); err != nil {
+		return err
+	}
+
+	if ip == "" || l.policy.IPMaxFailures <= 0 {
+		return nil
+	}
+
+	failures, err = l.store.RecordLoginFailure(ctx, ipKey(ip), l.policy.Window)
+	if err != nil {
+		return err
+	}
+	if failures >= l.policy.IPMaxFailures {
+		return l.store.BlockLogin(ctx, ipKey(ip), now.Add(l.policy.LockDuration))
+	}
+
+	return nil
+}
+
+// Reset forgets the failures of the account, after a successful login or
+// when an administrator unlocks it.
+func (l *Limiter) Reset(ctx context.Context, account string) error {
+	return l.store.ResetLoginAttempts(ctx, accountKey(account))
+}
+
+// delay returns the backoff after the given number of failures.
+func (l *Limiter) delay(failures int) time.Duration {
+	delay := l.policy.BaseDelay
+	for i := 1; i < failures && delay < l.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, l.policy.MaxDelay)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,223 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for the limiter.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(policy Policy) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	l := New(NewMemoryStore(), policy)
+	l.now = c.Now
+
+	return l, c
+}
+
+var testPolicy = Policy{
+	MaxFailures:   5,
+	LockDuration:  time.Hour,
+	BaseDelay:     time.Second,
+	MaxDelay:      4 * time.Second,
+	Window:        time.Hour,
+	IPMaxFailures: 3,
+}
+
+// checkRefused asserts that Check refuses with want for exactly retryAfter.
+func checkRefused(t *testing.T, l *Limiter, account, ip string, want error, retryAfter time.Duration) {
+	t.Helper()
+
+	err := l.Check(context.Background(), account, ip)
+	if !errors.Is(err, want) {
+		t.Fatalf("Check(%q, %q) = %v, want %v", account, ip, err, want)
+	}
+	if got := RetryAfter(err); got != retryAfter {
+		t.Fatalf("RetryAfter = %s, want %s", got, retryAfter)
+	}
+}
+
+func checkAllowed(t *testing.T, l *Limiter, account, ip string) {
+	t.Helper()
+
+	if err := l.Check(context.Background(), account, ip); err != nil {
+		t.Fatalf("Check(%q, %q) = %v, want nil", account, ip, err)
+	}
+}
+
+func fail(t *testing.T, l *Limiter, account, ip string) {
+	t.Helper()
+
+	if err := l.Fail(context.Background(), account, ip); err != nil {
+		t.Fatalf("Fail(%q, %q) = %v", account, ip, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	l, c := newTestLimiter(Policy{
+		MaxFailures:  10,
+		LockDuration: time.Hour,
+		BaseDelay:    time.Second,
+		MaxDelay:     4 * time.Second,
+		Window:       time.Hour,
+	})
+
+	checkAllowed(t, l, "user@example.com", "")
+
+	for _, delay := range []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		4 * time.Second,
+	} {
+		fail(t, l, "user@example.com", "")
+		checkRefused(t, l, "user@example.com", "", ErrTooManyAttempts, delay)
+
+		c.Advance(delay - time.Millisecond)
+		checkRefused(t, l, "user@example.com", "", ErrTooManyAttempts, time.Millisecond)
+
+		c.Advance(time.Millisecond)
+		checkAllowed(t, l, "user@example.com", "")
+	}
+
+	checkAllowed(t, l, "other@example.com", "")
+}
+
+func TestLock(t *testing.T) {
+	l, c := newTestLimiter(testPolicy)
+
+	for i := 1; i < testPolicy.MaxFailures; i++ {
+		fail(t, l, "user@example.com", "")
+		c.Advance(testPolicy.MaxDelay)
+	}
+	checkAllowed(t, l, "user@example.com", "")
+
+	fail(t, l, "user@example.com", "")
+	checkRefused(t, l, "user@example.com", "", ErrLocked, testPolicy.LockDuration)
+
+	c.Advance(testPolicy.LockDuration)
+	checkAllowed(t, l, "user@example.com", "")
+}
+
+func TestLockIgnoresEmailCase(t *testing.T) {
+	l, _ := newTestLimiter(testPolicy)
+
+	fail(t, l, "User@Example.com ", "")
+	checkRefused(t, l, "user@example.com", "", ErrTooManyAttempts, testPolicy.BaseDelay)
+}
+
+func TestIPLimit(t *testing.T) {
+	l, c := newTestLimiter(testPolicy)
+
+	accounts := []string{"a@example.com", "b@example.com", "c@example.com"}
+	for _, account := range accounts {
+		fail(t, l, account, "192.0.2.1")
+	}
+	c.Advance(testPolicy.BaseDelay)
+
+	// The accounts themselves only failed once, the address failed for all.
+	checkAllowed(t, l, "a@example.com", "")
+	checkRefused(t, l, "d@example.com", "192.0.2.1", ErrTooManyAttempts, testPolicy.LockDuration-testPolicy.BaseDelay)
+	checkAllowed(t, l, "d@example.com", "192.0.2.2")
+
+	c.Advance(testPolicy.LockDuration)
+	checkAllowed(t, l, "d@example.com", "192.0.2.1")
+}
+
+func TestIPLimitDisabled(t *testing.T) {
+	policy := testPolicy
+	policy.IPMaxFailures = 0
+	l, c := newTestLimiter(policy)
+
+	for i := 0; i < 10; i++ {
+		fail(t, l, string(rune('a'+i))+"@example.com", "192.0.2.1")
+	}
+	c.Advance(policy.BaseDelay)
+
+	checkAllowed(t, l, "z@example.com", "192.0.2.1")
+}
+
+func TestResetOnSuccess(t *testing.T) {
+	l, c := newTestLimiter(testPolicy)
+	ctx := context.Background()
+
+	for i := 1; i < testPolicy.MaxFailures; i++ {
+		fail(t, l, "user@example.com", "")
+		c.Advance(testPolicy.MaxDelay)
+	}
+
+	if err := l.Reset(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	checkAllowed(t, l, "user@example.com", "")
+
+	// The count starts over: the next failure gets the base delay instead
+	// of locking the account.
+	fail(t, l, "user@example.com", "")
+	checkRefused(t, l, "user@example.com", "", ErrTooManyAttempts, testPolicy.BaseDelay)
+}
+
+func TestResetUnlocks(t *testing.T) {
+	l, _ := newTestLimiter(testPolicy)
+
+	for i := 0; i < testPolicy.MaxFailures; i++ {
+		fail(t, l, "user@example.com", "")
+	}
+	checkRefused(t, l, "user@example.com", "", ErrLocked, testPolicy.LockDuration)
+
+	if err := l.Reset(context.Background(), "user@example.com"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	checkAllowed(t, l, "user@example.com", "")
+}
+
+func TestMemoryStoreDeleteStale(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, key := range []string{"stale", "blocked"} {
+		if _, err := store.RecordLoginFailure(ctx, key, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	if err := store.BlockLogin(ctx, "blocked", later.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := func(key string) int {
+		attempts, err := store.LoginAttempts(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return attempts.Failures
+	}
+
+	store.DeleteStale(time.Now(), time.Hour)
+	if failures("stale") != 1 || failures("blocked") != 1 {
+		t.Fatalf("recent failures were deleted")
+	}
+
+	store.DeleteStale(later, time.Hour)
+	if failures("stale") != 0 {
+		t.Errorf("stale failures were kept")
+	}
+	if failures("blocked") != 1 {
+		t.Errorf("failures of a blocked key were deleted")
+	}
+}
@@ -0,0 +1,87 @@
+package lockout
+
+import (
+	"context"
+	"sso/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process memory. It is meant for tests and
+// single instance setups; counters are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	attempts    models.LoginAttempts
+	lastFailure time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) LoginAttempts(_ context.Context, key string) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		return e.attempts, nil
+	}
+	return models.LoginAttempts{}, nil
+}
+
+func (s *MemoryStore) RecordLoginFailure(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	if now.Sub(e.lastFailure) > window {
+		e.attempts.Failures = 0
+	}
+
+	e.attempts.Failures++
+	e.lastFailure = now
+
+	return e.attempts.Failures, nil
+}
+
+func (s *MemoryStore) BlockLogin(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.attempts.BlockedUntil = until
+	}
+	return nil
+}
+
+func (s *MemoryStore) ResetLoginAttempts(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// DeleteStale drops the counters of keys that are not blocked at now and
+// have not failed for maxAge, so that long running processes do not keep
+// every key that ever failed.
+func (s *MemoryStore) DeleteStale(now time.Time, maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, e := range s.entries {
+		if e.lastFailure.Before(now.Add(-maxAge)) && e.attempts.BlockedUntil.Before(now) {
+			delete(s.entries, key)
+		}
+	}
+}
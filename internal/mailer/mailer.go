@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SenderLog  = "log"
+	SenderFile = "file"
+)
+
+// Sender delivers mail. Real SMTP or API based senders plug in here; the
+// log and file senders are meant for local runs.
+type Sender interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+func New(log *slog.Logger, kind string, from string, dir string) (Sender, error) {
+	switch kind {
+	case SenderLog, "":
+		return NewLogSender(log, from), nil
+	case SenderFile:
+		return NewFileSender(from, dir)
+	}
+
+	return nil, fmt.Errorf("unknown mail sender: %s", kind)
+}
+
+type LogSender struct {
+	log  *slog.Logger
+	from string
+}
+
+func NewLogSender(log *slog.Logger, from string) *LogSender {
+	return &LogSender{log: log, from: from}
+}
+
+func (s *LogSender) Send(_ context.Context, to string, subject string, body string) error {
+	s.log.Info("mail sent",
+		slog.String("from", s.from),
+		slog.String("to", to),
+		slog.String("subject", subject),
+		slog.String("body", body),
+	)
+
+	return nil
+}
+
+// FileSender writes every message as an .eml file into dir.
+type FileSender struct {
+	from string
+	dir  string
+	seq  atomic.Int64
+}
+
+func NewFileSender(from string, dir string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileSender{from: from, dir: dir}, nil
+}
+
+func (s *FileSender) Send(_ context.Context, to string, subject string, body string) error {
+	const op = "mailer.FileSender.Send"
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%d.eml", now.Format("20060102T150405"), s.seq.Add(1))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("\r\n")
+	b.WriteString(body)
+
+	if err := os.WriteFile(filepath.Join(s.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prefixLength is the length of the hash prefix that names a range file.
+const prefixLength = 5
+
+// RangeDir is a breached password list stored as k-anonymity range files,
+// the layout of the Pwned Passwords range API: the directory holds one
+// file per five hex digit prefix of the uppercase SHA-1 hash, named after
+// the prefix, with "SUFFIX:COUNT" lines for the hashes sharing it. Only the
+// file of the password's prefix is read.
+type RangeDir struct {
+	dir string
+}
+
+func NewRangeDir(dir string) (*RangeDir, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+
+	return &RangeDir{dir: dir}, nil
+}
+
+func (d *RangeDir) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
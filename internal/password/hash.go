@@ -0,0 +1,157 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	AlgBcrypt   = "bcrypt"
+	AlgArgon2id = "argon2id"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+var argon2idPrefix = []byte("$argon2id$")
+
+var b64 = base64.RawStdEncoding
+
+// Bcrypt hashes passwords with bcrypt. Its hashes are in the usual
+// $2a$<cost>$... form.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+}
+
+// Verify asks for a rehash of hashes of other algorithms and of bcrypt
+// hashes with a lower cost.
+func (b Bcrypt) Verify(password string, encoded []byte) (bool, bool, error) {
+	match, err := verify(password, encoded)
+	if err != nil || !match {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost(encoded)
+	if err != nil {
+		return true, true, nil
+	}
+
+	return true, cost < b.Cost, nil
+}
+
+// Argon2id hashes passwords with Argon2id. Its hashes are in the PHC string
+// format, $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>, with
+// unpadded base64 salt and key.
+type Argon2id struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is in KiB.
+	Memory  uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id follows the second recommended option of RFC 9106.
+var DefaultArgon2id = Argon2id{Time: 3, Memory: 64 * 1024, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+func (a Argon2id) Hash(password string) ([]byte, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads, b64.EncodeToString(salt), b64.EncodeToString(key),
+	)), nil
+}
+
+// Verify asks for a rehash of hashes of other algorithms and of Argon2id
+// hashes with any parameter weaker than a's.
+func (a Argon2id) Verify(password string, encoded []byte) (bool, bool, error) {
+	match, err := verify(password, encoded)
+	if err != nil || !match {
+		return false, false, err
+	}
+
+	params, _, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true, true, nil
+	}
+
+	weaker := params.Time < a.Time ||
+		params.Memory < a.Memory ||
+		params.Threads < a.Threads ||
+		uint32(len(key)) < a.KeyLen
+
+	return true, weaker, nil
+}
+
+// verify checks password against a hash of any supported algorithm.
+func verify(password string, encoded []byte) (bool, error) {
+	if bytes.HasPrefix(encoded, argon2idPrefix) {
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+
+	if _, err := bcrypt.Cost(encoded); err != nil {
+		return false, ErrUnknownHash
+	}
+
+	err := bcrypt.CompareHashAndPassword(encoded, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func decodeArgon2id(encoded []byte) (params Argon2id, salt []byte, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+	if key, err = b64.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,173 @@
+// Package password checks new passwords against the configured policy and
+// hashes them.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BcryptMaxLength is the number of bytes bcrypt takes into account; longer
+// passwords are rejected by it.
+const BcryptMaxLength = 72
+
+// minPersonalInfoLength keeps very short names from ruling out passwords.
+const minPersonalInfoLength = 3
+
+// Rules reported in violations.
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleCharClasses  = "character_classes"
+	RulePersonalInfo = "personal_info"
+	RuleBreached     = "breached"
+	RuleEncoding     = "encoding"
+)
+
+var ErrWeakPassword = errors.New("password does not satisfy the policy")
+
+// Violation is a rule the password failed.
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// Error lists every rule a password failed. It matches ErrWeakPassword.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	descriptions := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		descriptions[i] = v.Description
+	}
+
+	return ErrWeakPassword.Error() + ": " + strings.Join(descriptions, "; ")
+}
+
+func (e *Error) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Violations returns the violations of err, or nil when err is not a
+// policy error.
+func Violations(err error) []Violation {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Violations
+	}
+	return nil
+}
+
+// BreachedList reports passwords known from data breaches.
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// Policy describes acceptable passwords. Zero values disable a rule.
+type Policy struct {
+	MinLength int
+	// MaxLength is in bytes.
+	MaxLength int
+	// MinCharClasses is how many of lowercase letters, uppercase letters,
+	// digits and symbols the password has to contain.
+	MinCharClasses       int
+	DisallowPersonalInfo bool
+	Breached             BreachedList
+}
+
+// Validate checks password against the policy. personal holds the email
+// and names of the user, which the password must not contain. It returns
+// an *Error listing the violations, or another error when the breached
+// password list cannot be read.
+func (p *Policy) Validate(password string, personal ...string) error {
+	var violations []Violation
+
+	if !utf8.ValidString(password) {
+		violations = append(violations, Violation{RuleEncoding, "must be valid UTF-8"})
+	}
+
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			RuleMinLength, fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, Violation{
+			RuleMaxLength, fmt.Sprintf("must be at most %d bytes long", p.MaxLength),
+		})
+	}
+
+	if p.MinCharClasses > 0 && charClasses(password) < p.MinCharClasses {
+		violations = append(violations, Violation{
+			RuleCharClasses,
+			fmt.Sprintf("must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinCharClasses),
+		})
+	}
+
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, personal) {
+		violations = append(violations, Violation{RulePersonalInfo, "must not contain the email address or name"})
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, Violation{RuleBreached, "appears in a list of breached passwords"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+// containsPersonalInfo reports whether the password contains one of the
+// values, or the local part of an email address among them.
+func containsPersonalInfo(password string, personal []string) bool {
+	password = strings.ToLower(password)
+
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		candidates := []string{value}
+		if local, _, found := strings.Cut(value, "@"); found {
+			candidates = append(candidates, local)
+		}
+
+		for _, c := range candidates {
+			if utf8.RuneCountInString(c) >= minPersonalInfoLength && strings.Contains(password, c) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
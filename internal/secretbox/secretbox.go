@@ -0,0 +1,86 @@
+// Package secretbox encrypts secrets that have to be stored in a readable
+// form, such as app secrets used for HS256 signing and the private keys of
+// app key rings.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const prefix = "enc:v1:"
+
+var ErrNoKey = errors.New("secret is encrypted but no encryption key is configured")
+
+// Box seals values with AES-256-GCM. A nil Box stores values as they are,
+// which keeps local setups without an encryption key working.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a box from a base64 encoded 32 byte key.
+func New(encodedKey string) (*Box, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	if b == nil {
+		return string(plaintext), nil
+	}
+
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, plaintext, nil)
+
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal. Values without the encryption
+// prefix were stored before encryption was enabled and are returned as is.
+func (b *Box) Open(value string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return []byte(value), nil
+	}
+	if b == nil {
+		return nil, ErrNoKey
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := b.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("sealed value is too short")
+	}
+
+	return b.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+}
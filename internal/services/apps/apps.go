@@ -0,0 +1,240 @@
+package apps
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+)
+
+var (
+	ErrAppNotFound   = errors.New("app not found")
+	ErrAppExists     = errors.New("app already exists")
+	ErrInvalidClient = errors.New("invalid client settings")
+)
+
+type AppProvider interface {
+	SaveApp(ctx context.Context, app models.App) (int, error)
+	App(ctx context.Context, appID int) (models.App, error)
+	Apps(ctx context.Context) ([]models.App, error)
+	UpdateApp(ctx context.Context, app models.App) error
+	UpdateAppSecret(ctx context.Context, appID int, secret string) error
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+// SecretSealer encrypts app secrets before they are stored.
+type SecretSealer interface {
+	Seal(plaintext []byte) (string, error)
+}
+
+// Apps manages client applications. Callers are responsible for checking
+// that the caller may manage apps.
+type Apps struct {
+	log         *slog.Logger
+	appProvider AppProvider
+	sealer      SecretSealer
+}
+
+func New(log *slog.Logger, appProvider AppProvider, sealer SecretSealer) *Apps {
+	return &Apps{
+		log:         log,
+		appProvider: appProvider,
+		sealer:      sealer,
+	}
+}
+
+// CreateApp registers a new app. The returned app carries the plain secret,
+// which is not retrievable afterwards.
+func (a *Apps) CreateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "Apps.CreateApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("name", app.Name),
+	)
+
+	if err := validateClient(app); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sealed, err := a.sealer.Seal([]byte(secret))
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app.Secret = sealed
+
+	app.ID, err = a.appProvider.SaveApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+
+		log.Error("failed to save app", sl.Err(err))
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app created", slog.Int("app_id", app.ID))
+
+	app.Secret = secret
+
+	return app, nil
+}
+
+func (a *Apps) GetApp(ctx context.Context, appID int) (models.App, error) {
+	const op = "Apps.GetApp"
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, mapErr(err))
+	}
+
+	app.Secret = ""
+
+	return app, nil
+}
+
+func (a *Apps) ListApps(ctx context.Context) ([]models.App, error) {
+	const op = "Apps.ListApps"
+
+	apps, err := a.appProvider.Apps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range apps {
+		apps[i].Secret = ""
+	}
+
+	return apps, nil
+}
+
+func (a *Apps) UpdateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "Apps.UpdateApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", app.ID),
+	)
+
+	if err := validateClient(app); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appProvider.UpdateApp(ctx, app); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, mapErr(err))
+	}
+
+	log.Info("app updated")
+
+	return a.GetApp(ctx, app.ID)
+}
+
+// RotateAppSecret replaces the app secret and returns the new one. Tokens
+// signed with the old secret stop verifying at once; apps that need a grace
+// period should sign with a key ring instead.
+func (a *Apps) RotateAppSecret(ctx context.Context, appID int) (string, error) {
+	const op = "Apps.RotateAppSecret"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	sealed, err := a.sealer.Seal([]byte(secret))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appProvider.UpdateAppSecret(ctx, appID, sealed); err != nil {
+		return "", fmt.Errorf("%s: %w", op, mapErr(err))
+	}
+
+	log.Info("app secret rotated")
+
+	return secret, nil
+}
+
+func (a *Apps) DeleteApp(ctx context.Context, appID int) error {
+	const op = "Apps.DeleteApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	if err := a.appProvider.DeleteApp(ctx, appID); err != nil {
+		return fmt.Errorf("%s: %w", op, mapErr(err))
+	}
+
+	log.Info("app deleted")
+
+	return nil
+}
+
+// validateClient checks the OAuth2 client settings of the app.
+func validateClient(app models.App) error {
+	if app.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidClient)
+	}
+
+	switch app.ClientType {
+	case models.ClientTypeConfidential, models.ClientTypePublic:
+	default:
+		return fmt.Errorf("%w: unknown client type %q", ErrInvalidClient, app.ClientType)
+	}
+
+	if app.ClientType == models.ClientTypePublic && len(app.ClientScopes) > 0 {
+		return fmt.Errorf("%w: public clients cannot use the client credentials grant", ErrInvalidClient)
+	}
+
+	if app.AccessTokenTTL < 0 || app.RefreshTokenTTL < 0 {
+		return fmt.Errorf("%w: token lifetimes cannot be negative", ErrInvalidClient)
+	}
+
+	for _, uri := range app.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("%w: redirect uri %q must be absolute without a fragment", ErrInvalidClient, uri)
+		}
+	}
+
+	return nil
+}
+
+func mapErr(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrAppNotFound):
+		return ErrAppNotFound
+	case errors.Is(err, storage.ErrAppExists):
+		return ErrAppExists
+	}
+	return err
+}
+
+func newSecret() (string, error) {
+	randomBytes := make([]byte, 32)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"time"
+)
+
+var (
+	ErrUserNotActivated       = errors.New("user not activated")
+	ErrInvalidActivationToken = errors.New("invalid activation token")
+)
+
+// sendActivationToken replaces any pending activation token of the user with
+// a new one and mails it.
+func (a *Auth) sendActivationToken(ctx context.Context, userID int64, email string) error {
+	if err := a.authProvider.DeleteScopedTokens(ctx, userID, storage.ScopeActivation); err != nil {
+		return err
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiry := time.Now().Add(a.activationTokenTTL)
+	if err := a.authProvider.SaveScopedToken(ctx, token, userID, storage.ScopeActivation, expiry); err != nil {
+		return err
+	}
+
+	if a.mailer == nil {
+		a.log.Warn("no mailer configured, activation token not sent", slog.Int64("user_id", userID))
+		return nil
+	}
+
+	body := fmt.Sprintf(
+		"Please activate your account with the following token:\n\n%s\n\nThe token expires at %s.\n",
+		token, expiry.Format(time.RFC1123),
+	)
+
+	return a.mailer.Send(ctx, email, "Activate your account", body)
+}
+
+// SendActivation mails a new activation token to the user, for instance
+// after their email changed.
+func (a *Auth) SendActivation(ctx context.Context, userID int64, email string) error {
+	const op = "Auth.SendActivation"
+
+	if err := a.sendActivationToken(ctx, userID, email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ActivateUser consumes an activation token and marks its user activated.
+func (a *Auth) ActivateUser(ctx context.Context, token string) (int64, error) {
+	const op = "Auth.ActivateUser"
+
+	log := a.log.With(slog.String("op", op))
+
+	userID, err := a.authProvider.ConsumeToken(ctx, token, storage.ScopeActivation)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("activation token not found")
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidActivationToken)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.ActivateUser(ctx, userID); err != nil {
+		log.Error("failed to activate user", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user activated", slog.Int64("user_id", userID))
+
+	return userID, nil
+}
@@ -0,0 +1,171 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage/memory"
+	"sso/internal/lockout"
+	"sso/internal/password"
+	"sso/internal/services/auth"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery staple"
+
+// newTestAuth returns an Auth over an in-memory storage holding a single
+// app, and the id of that app.
+func newTestAuth(t *testing.T, opts ...auth.Option) (*auth.Auth, int) {
+	t.Helper()
+
+	storage, err := memory.Open("memory://?app=test:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts = append([]auth.Option{auth.WithPasswordHasher(password.Bcrypt{Cost: 4})}, opts...)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return auth.New(log, time.Hour, 24*time.Hour, auth.NewKeySet(key), storage, opts...), 1
+}
+
+func registerUser(t *testing.T, a *auth.Auth, email string) int64 {
+	t.Helper()
+
+	userID, err := a.RegisterNewUser(context.Background(), "Test", "User", email, testPassword)
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	return userID
+}
+
+// newLockoutAuth returns an Auth that locks accounts after maxFailures
+// failed logins, without any backoff in between.
+func newLockoutAuth(t *testing.T, maxFailures int) (*auth.Auth, int) {
+	t.Helper()
+
+	limiter := lockout.New(lockout.NewMemoryStore(), lockout.Policy{
+		MaxFailures:  maxFailures,
+		LockDuration: time.Hour,
+		Window:       time.Hour,
+	})
+
+	return newTestAuth(t, auth.WithLockout(limiter))
+}
+
+func TestLoginLocksAccount(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newLockoutAuth(t, 3)
+	registerUser(t, a, "user@example.com")
+
+	for i := 0; i < 3; i++ {
+		_, err := a.Login(ctx, "user@example.com", "wrong password", appID)
+		if !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, auth.ErrInvalidCredentials)
+		}
+	}
+
+	_, err := a.Login(ctx, "user@example.com", testPassword, appID)
+	if !errors.Is(err, auth.ErrAccountLocked) {
+		t.Fatalf("correct password on locked account: got %v, want %v", err, auth.ErrAccountLocked)
+	}
+	if lockout.RetryAfter(err) <= 0 {
+		t.Errorf("locked account without retry time")
+	}
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newLockoutAuth(t, 3)
+	registerUser(t, a, "user@example.com")
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			if _, err := a.Login(ctx, "user@example.com", "wrong password", appID); !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Fatalf("round %d: got %v, want %v", round, err, auth.ErrInvalidCredentials)
+			}
+		}
+
+		if _, err := a.Login(ctx, "user@example.com", testPassword, appID); err != nil {
+			t.Fatalf("round %d: login after 2 failures: %v", round, err)
+		}
+	}
+}
+
+func login(t *testing.T, a *auth.Auth, email string, appID int) models.TokenPair {
+	t.Helper()
+
+	pair, err := a.Login(context.Background(), email, testPassword, appID)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return pair
+}
+
+// authenticated reports whether the access token is accepted.
+func authenticated(t *testing.T, a *auth.Auth, token string) bool {
+	t.Helper()
+
+	ok, _, err := a.IsAuthenticated(context.Background(), token)
+	if err != nil {
+		t.Fatalf("IsAuthenticated: %v", err)
+	}
+
+	return ok
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	userID := registerUser(t, a, "user@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+	if pair.RefreshToken == "" {
+		t.Errorf("no refresh token issued")
+	}
+
+	ok, tokenUserID, err := a.IsAuthenticated(ctx, pair.AccessToken)
+	if err != nil || !ok || tokenUserID != userID {
+		t.Errorf("IsAuthenticated = %t, %d, %v; want true, %d, nil", ok, tokenUserID, err, userID)
+	}
+
+	claims, err := a.VerifyToken(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if claims.Email != "user@example.com" || claims.AppID != appID {
+		t.Errorf("claims for %s in app %d, want user@example.com in app %d", claims.Email, claims.AppID, appID)
+	}
+}
+
+func TestLoginRejectsInvalidCredentials(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+
+	for _, tt := range []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "wrong password", email: "user@example.com", password: "wrong password"},
+		{name: "unknown email", email: "nobody@example.com", password: testPassword},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Login(ctx, tt.email, tt.password, appID)
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Errorf("got %v, want %v", err, auth.ErrInvalidCredentials)
+			}
+		})
+	}
+}
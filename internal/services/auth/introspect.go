@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"strconv"
+	"time"
+)
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// Introspection describes a token as defined by RFC 7662. Inactive tokens
+// carry no other fields.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	AppID     int      `json:"app_id,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	AppRoles  []string `json:"app_roles,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Expiry    int64    `json:"exp,omitempty"`
+}
+
+// IntrospectToken describes an access, client or refresh token to a
+// confidential client such as a resource server. hint is the RFC 7009
+// token_type_hint; it only changes the lookup order.
+func (a *Auth) IntrospectToken(
+	ctx context.Context,
+	clientID int,
+	clientSecret string,
+	token string,
+	hint string,
+) (Introspection, error) {
+	const op = "Auth.IntrospectToken"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("client_id", clientID),
+	)
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return Introspection{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if app.ClientType == models.ClientTypePublic {
+		return Introspection{}, fmt.Errorf("%s: %w", op, ErrUnauthorizedClient)
+	}
+
+	info, err := a.introspect(ctx, token, hint)
+	if err != nil {
+		return Introspection{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("token introspected", slog.Bool("active", info.Active), slog.String("token_type", info.TokenType))
+
+	return info, nil
+}
+
+// RevokeToken revokes an access, client or refresh token of the client as
+// defined by RFC 7009. Revoking a user token also revokes its refresh token
+// family. Unknown tokens are ignored.
+func (a *Auth) RevokeToken(
+	ctx context.Context,
+	clientID int,
+	clientSecret string,
+	token string,
+	hint string,
+) error {
+	const op = "Auth.RevokeToken"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("client_id", clientID),
+	)
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := a.introspect(ctx, token, hint)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !info.Active {
+		return nil
+	}
+	if info.AppID != app.ID {
+		return fmt.Errorf("%s: %w: token was issued to another client", op, ErrUnauthorizedClient)
+	}
+
+	switch {
+	case info.TokenType == TokenTypeRefresh:
+		refresh, err := a.authProvider.RefreshToken(ctx, token)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := a.authProvider.RevokeRefreshTokenFamily(ctx, refresh.FamilyID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		a.tokensRevoked()
+	case info.Subject == "":
+		if err := a.authProvider.RevokeClientToken(ctx, token); err != nil && !errors.Is(err, storage.ErrTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		a.tokensRevoked()
+	default:
+		if err := a.Logout(ctx, token); err != nil && !errors.Is(err, ErrInvalidToken) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("token revoked", slog.String("token_type", info.TokenType))
+
+	return nil
+}
+
+// introspect looks the token up as an access, client and refresh token in
+// turn, starting with refresh tokens when hinted to.
+func (a *Auth) introspect(ctx context.Context, token string, hint string) (Introspection, error) {
+	lookups := []func(context.Context, string) (Introspection, error){
+		a.introspectAccessToken,
+		a.introspectClientToken,
+		a.introspectRefreshToken,
+	}
+	if hint == TokenTypeRefresh {
+		lookups[0], lookups[2] = lookups[2], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		info, err := lookup(ctx, token)
+		if err != nil || info.Active {
+			return info, err
+		}
+	}
+
+	return Introspection{}, nil
+}
+
+func (a *Auth) introspectAccessToken(ctx context.Context, token string) (Introspection, error) {
+	isAuthenticated, userID, err := a.authProvider.IsAuthenticated(ctx, token)
+	if err != nil || !isAuthenticated {
+		return Introspection{}, err
+	}
+
+	claims, err := a.VerifyToken(ctx, token)
+	if err != nil {
+		return Introspection{}, nil
+	}
+
+	info := Introspection{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		Subject:   strconv.FormatInt(userID, 10),
+		ClientID:  strconv.Itoa(claims.AppID),
+		AppID:     claims.AppID,
+		Scope:     claims.Scope,
+		Roles:     claims.Roles,
+		AppRoles:  claims.AppRoles,
+	}
+	if claims.IssuedAt != nil {
+		info.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.ExpiresAt != nil {
+		info.Expiry = claims.ExpiresAt.Unix()
+	}
+
+	return info, nil
+}
+
+func (a *Auth) introspectClientToken(ctx context.Context, token string) (Introspection, error) {
+	clientToken, ok, err := a.AuthenticateClientToken(ctx, token)
+	if err != nil || !ok {
+		return Introspection{}, err
+	}
+
+	info := Introspection{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		ClientID:  strconv.Itoa(clientToken.AppID),
+		AppID:     clientToken.AppID,
+		Scope:     clientToken.Scope,
+		Expiry:    clientToken.Expiry.Unix(),
+	}
+
+	if claims, err := a.VerifyToken(ctx, token); err == nil && claims.IssuedAt != nil {
+		info.IssuedAt = claims.IssuedAt.Unix()
+	}
+
+	return info, nil
+}
+
+func (a *Auth) introspectRefreshToken(ctx context.Context, token string) (Introspection, error) {
+	refresh, err := a.authProvider.RefreshToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return Introspection{}, nil
+		}
+
+		return Introspection{}, err
+	}
+
+	if refresh.Used || refresh.Revoked || time.Now().After(refresh.Expiry) {
+		return Introspection{}, nil
+	}
+
+	return Introspection{
+		Active:    true,
+		TokenType: TokenTypeRefresh,
+		Subject:   strconv.FormatInt(refresh.UserID, 10),
+		ClientID:  strconv.Itoa(refresh.AppID),
+		AppID:     refresh.AppID,
+		Expiry:    refresh.Expiry.Unix(),
+	}, nil
+}
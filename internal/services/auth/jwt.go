@@ -13,22 +13,63 @@ var (
 )
 
 type TokenClaims struct {
-	UID   int    `json:"uid"`
-	Email string `json:"email"`
-	AppID int    `json:"app_id"`
-	jwt.MapClaims
+	UID         int      `json:"uid"`
+	Email       string   `json:"email"`
+	AppID       int      `json:"app_id"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	AppRoles    []string `json:"app_roles,omitempty"`
+	ClientID    int      `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	jwt.RegisteredClaims
 }
 
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// NewToken signs the token with key when it is set and falls back to HS256
+// with the app secret otherwise. id keeps tokens issued to the same user in
+// the same second apart. scope is the OAuth2 scope the token was granted,
+// empty outside of the authorization code flow.
+func NewToken(
+	user models.User,
+	app models.App,
+	key *SigningKey,
+	id string,
+	scope string,
+	issuedAt time.Time,
+	expiry time.Time,
+) (string, error) {
+	method := jwt.SigningMethod(jwt.SigningMethodHS256)
+	var signingKey any = []byte(app.Secret)
+	if key != nil {
+		method = key.method()
+		signingKey = key.signingKey()
+	}
+
+	token := jwt.New(method)
+	if key != nil {
+		token.Header["kid"] = key.ID
+	}
 
 	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = id
 	claims["uid"] = user.ID
 	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["iat"] = issuedAt.Unix()
+	claims["exp"] = expiry.Unix()
 	claims["app_id"] = app.ID
+	if len(user.Roles) > 0 {
+		claims["roles"] = user.Roles
+	}
+	if len(user.Permissions) > 0 {
+		claims["permissions"] = user.Permissions
+	}
+	if len(user.AppRoles) > 0 {
+		claims["app_roles"] = user.AppRoles
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
 
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	tokenString, err := token.SignedString(signingKey)
 	if err != nil {
 		return "", err
 	}
@@ -36,9 +77,56 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 	return tokenString, nil
 }
 
-func DecodeToken(appSecret string, tokenString string) (*TokenClaims, error) {
+// NewClientToken signs a client credentials access token. It has no user
+// subject; client_id names the app the token was issued to.
+func NewClientToken(app models.App, key *SigningKey, scope string, id string, issuedAt time.Time, expiry time.Time) (string, error) {
+	method := jwt.SigningMethod(jwt.SigningMethodHS256)
+	var signingKey any = []byte(app.Secret)
+	if key != nil {
+		method = key.method()
+		signingKey = key.signingKey()
+	}
+
+	claims := jwt.MapClaims{
+		"jti":       id,
+		"app_id":    app.ID,
+		"client_id": app.ID,
+		"iat":       issuedAt.Unix(),
+		"exp":       expiry.Unix(),
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if key != nil {
+		token.Header["kid"] = key.ID
+	}
+
+	return token.SignedString(signingKey)
+}
+
+// DecodeToken verifies tokenString against the key named by its kid header.
+// Tokens without a kid are HS256 tokens signed with the app secret.
+func DecodeToken(appSecret string, keys *KeySet, tokenString string) (*TokenClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(appSecret), nil
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || appSecret == "" {
+				return nil, ErrUnknownKey
+			}
+			return []byte(appSecret), nil
+		}
+
+		key, err := keys.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != token.Method.Alg() {
+			return nil, ErrUnsupportedAlgorithm
+		}
+
+		return key.verificationKey(), nil
 	})
 
 	if err != nil {
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/sl"
+	"time"
+)
+
+// appKeys returns the key ring of the app. Apps without a key ring fall
+// back to the globally configured keys. Tokens signed with those before the
+// first rotation stay valid, so the global keys keep verifying tokens of the
+// app for the access token lifetime after its first key was created.
+func (a *Auth) appKeys(ctx context.Context, app models.App) (*KeySet, error) {
+	stored, err := a.authProvider.AppSigningKeys(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) == 0 {
+		return a.keys, nil
+	}
+
+	var (
+		active  *SigningKey
+		others  = make([]*SigningKey, 0, len(stored))
+		created = stored[0].CreatedAt
+	)
+	for _, sk := range stored {
+		key, err := a.parseStoredKey(sk)
+		if err != nil {
+			return nil, err
+		}
+
+		if sk.Active {
+			active = key
+		} else {
+			others = append(others, key)
+		}
+		if sk.CreatedAt.Before(created) {
+			created = sk.CreatedAt
+		}
+	}
+
+	if time.Now().Before(created.Add(max(a.tokenTTL, a.appAccessTokenTTL(app)))) {
+		others = append(others, a.keys.all()...)
+	}
+
+	return NewKeySet(active, others...), nil
+}
+
+// parseStoredKey opens the private key of a key ring entry, which is sealed
+// like app secrets when an encryption key is configured.
+func (a *Auth) parseStoredKey(sk models.SigningKey) (*SigningKey, error) {
+	privateKey := sk.PrivateKey
+	if a.keySecrets != nil {
+		opened, err := a.keySecrets.Open(string(sk.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: open private key: %w", sk.ID, err)
+		}
+		privateKey = opened
+	}
+
+	if sk.Algorithm == AlgHS256 {
+		return &SigningKey{ID: sk.ID, Algorithm: sk.Algorithm, Secret: privateKey}, nil
+	}
+
+	key, err := ParseSigningKey(sk.Algorithm, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", sk.ID, err)
+	}
+	key.ID = sk.ID
+
+	return key, nil
+}
+
+// RotateSigningKey generates a new active key for the app. The previous key
+// keeps verifying tokens for overlap, which is never shorter than the access
+// token lifetime of the app, nor the server default it may have issued
+// tokens with before, so that outstanding tokens stay valid.
+func (a *Auth) RotateSigningKey(ctx context.Context, appID int, alg string, overlap time.Duration) (string, error) {
+	const op = "Auth.RotateSigningKey"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.String("algorithm", alg),
+	)
+
+	app, err := a.authProvider.App(ctx, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	privateKey, err := key.MarshalPrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if a.keySecrets != nil {
+		sealed, err := a.keySecrets.Seal(privateKey)
+		if err != nil {
+			return "", fmt.Errorf("%s: seal private key: %w", op, err)
+		}
+		privateKey = []byte(sealed)
+	}
+
+	overlap = max(overlap, a.tokenTTL, a.appAccessTokenTTL(app))
+
+	err = a.authProvider.RotateSigningKey(ctx, models.SigningKey{
+		ID:         key.ID,
+		AppID:      appID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: privateKey,
+	}, time.Now().Add(overlap))
+	if err != nil {
+		log.Error("failed to rotate signing key", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("signing key rotated", slog.String("kid", key.ID), slog.Duration("overlap", overlap))
+
+	return key.ID, nil
+}
+
+// VerifyToken checks the signature and expiry of an access token using the
+// key ring of the app the token was issued for.
+func (a *Auth) VerifyToken(ctx context.Context, token string) (*TokenClaims, error) {
+	const op = "Auth.VerifyToken"
+
+	var unverified TokenClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &unverified); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNotValidJwt)
+	}
+
+	app, err := a.app(ctx, unverified.AppID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := a.appKeys(ctx, app)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims, err := DecodeToken(app.Secret, keys, token)
+	if err != nil {
+		if errors.Is(err, ErrNotValidJwt) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"sso/internal/domain/storage/memory"
+	"sso/internal/password"
+	"sso/internal/secretbox"
+	"sso/internal/services/auth"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateSigningKeyKeepsGlobalKey(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+
+	before := login(t, a, "user@example.com", appID)
+
+	if _, err := a.RotateSigningKey(ctx, appID, auth.AlgEdDSA, 0); err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+	after := login(t, a, "user@example.com", appID)
+
+	for name, token := range map[string]string{"before": before.AccessToken, "after": after.AccessToken} {
+		if _, err := a.VerifyToken(ctx, token); err != nil {
+			t.Errorf("token issued %s the first rotation: %v", name, err)
+		}
+	}
+}
+
+func TestRotateSigningKeySealsPrivateKey(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := memory.Open("memory://?app=test:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := secretbox.New(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := auth.New(log, time.Hour, 24*time.Hour, nil, storage,
+		auth.WithPasswordHasher(password.Bcrypt{Cost: 4}),
+		auth.WithSigningKeySecrets(box),
+	)
+	registerUser(t, a, "user@example.com")
+
+	kid, err := a.RotateSigningKey(ctx, 1, auth.AlgEdDSA, 0)
+	if err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+
+	stored, err := storage.AppSigningKeys(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].ID != kid {
+		t.Fatalf("stored keys %+v, want %s", stored, kid)
+	}
+	if !strings.HasPrefix(string(stored[0].PrivateKey), "enc:") {
+		t.Errorf("private key stored in plaintext")
+	}
+
+	pair := login(t, a, "user@example.com", 1)
+	if _, err := a.VerifyToken(ctx, pair.AccessToken); err != nil {
+		t.Errorf("token signed with the sealed key: %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"sort"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownKey           = errors.New("unknown signing key")
+)
+
+// SigningKey signs access tokens. Asymmetric keys carry PrivateKey, HS256
+// keys from an app key ring carry Secret. ID is written to the kid header so
+// verifiers can pick the right key.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	Secret     []byte
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgHS256:
+		return jwt.SigningMethodHS256
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+	return nil
+}
+
+func (k *SigningKey) signingKey() any {
+	if k.Algorithm == AlgHS256 {
+		return k.Secret
+	}
+	return k.PrivateKey
+}
+
+func (k *SigningKey) verificationKey() any {
+	if k.Algorithm == AlgHS256 {
+		return k.Secret
+	}
+	return k.PublicKey()
+}
+
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	if k.PrivateKey == nil {
+		return nil
+	}
+	return k.PrivateKey.Public()
+}
+
+// GenerateSigningKey creates a new key for the given algorithm.
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var signer crypto.Signer
+
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		kid := make([]byte, 16)
+		if _, err := rand.Read(kid); err != nil {
+			return nil, err
+		}
+		return &SigningKey{
+			ID:        base64.RawURLEncoding.EncodeToString(kid),
+			Algorithm: alg,
+			Secret:    secret,
+		}, nil
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+
+	return newSigningKey(alg, signer)
+}
+
+// LoadSigningKey reads a PEM encoded PKCS#8 (or PKCS#1 for RSA) private key.
+func LoadSigningKey(alg string, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSigningKey(alg, data)
+}
+
+func ParseSigningKey(alg string, pemData []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key any
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		var pkcs1Err error
+		key, pkcs1Err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if pkcs1Err != nil {
+			return nil, err
+		}
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg != AlgRS256 {
+			return nil, fmt.Errorf("%w: RSA key for %s", ErrUnsupportedAlgorithm, alg)
+		}
+		return newSigningKey(alg, k)
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return nil, fmt.Errorf("%w: Ed25519 key for %s", ErrUnsupportedAlgorithm, alg)
+		}
+		return newSigningKey(alg, k)
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, key)
+}
+
+// MarshalPrivateKey encodes the private key as PEM PKCS#8. HS256 keys are
+// returned as the raw secret.
+func (k *SigningKey) MarshalPrivateKey() ([]byte, error) {
+	if k.Algorithm == AlgHS256 {
+		return k.Secret, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func newSigningKey(alg string, signer crypto.Signer) (*SigningKey, error) {
+	key := &SigningKey{Algorithm: alg, PrivateKey: signer}
+
+	jwk, err := key.JWK()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = jwk.thumbprint()
+
+	return key, nil
+}
+
+// JWK is the public half of a signing key as described in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *SigningKey) JWK() (JWK, error) {
+	enc := base64.RawURLEncoding
+
+	switch pub := k.PublicKey().(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Algorithm,
+			N:         enc.EncodeToString(pub.N.Bytes()),
+			E:         enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Algorithm,
+			Curve:     "Ed25519",
+			X:         enc.EncodeToString(pub),
+		}, nil
+	}
+
+	return JWK{}, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, k.PublicKey())
+}
+
+// thumbprint computes the RFC 7638 thumbprint, which we use as the kid.
+func (j JWK) thumbprint() string {
+	var required any
+	switch j.KeyType {
+	case "RSA":
+		required = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	default:
+		required = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	}
+
+	data, _ := json.Marshal(required)
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeySet holds the keys that sign and verify access tokens. The active key
+// signs new tokens; every key in the set is accepted for verification.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeySet(active *SigningKey, others ...*SigningKey) *KeySet {
+	ks := &KeySet{
+		active: active,
+		keys:   make(map[string]*SigningKey, len(others)+1),
+	}
+
+	if active != nil {
+		ks.keys[active.ID] = active
+	}
+	for _, k := range others {
+		ks.keys[k.ID] = k
+	}
+
+	return ks
+}
+
+// Active returns the signing key, or nil when tokens are signed with the
+// app secret (HS256).
+func (ks *KeySet) Active() *SigningKey {
+	if ks == nil {
+		return nil
+	}
+	return ks.active
+}
+
+func (ks *KeySet) Key(kid string) (*SigningKey, error) {
+	if ks == nil {
+		return nil, ErrUnknownKey
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// all returns every key of the set.
+func (ks *KeySet) all() []*SigningKey {
+	if ks == nil {
+		return nil
+	}
+
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func (ks *KeySet) JWKS() (JWKS, error) {
+	jwks := JWKS{Keys: []JWK{}}
+	if ks == nil {
+		return jwks, nil
+	}
+
+	for _, k := range ks.keys {
+		if k.Algorithm == AlgHS256 {
+			continue
+		}
+
+		jwk, err := k.JWK()
+		if err != nil {
+			return JWKS{}, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"sso/internal/domain/models"
+	"time"
+)
+
+var ErrSessionExpired = errors.New("session reached its maximum lifetime")
+
+// appAccessTokenTTL is the app's access token lifetime, or the server
+// default.
+func (a *Auth) appAccessTokenTTL(app models.App) time.Duration {
+	if app.AccessTokenTTL > 0 {
+		return app.AccessTokenTTL
+	}
+	return a.tokenTTL
+}
+
+// appRefreshTokenTTL is the app's refresh token lifetime, or the server
+// default.
+func (a *Auth) appRefreshTokenTTL(app models.App) time.Duration {
+	if app.RefreshTokenTTL > 0 {
+		return app.RefreshTokenTTL
+	}
+	return a.refreshTokenTTL
+}
+
+// tokenExpiry decides when the access and refresh tokens issued at now for
+// a session started at started expire. Both are cut off at the end of the
+// maximum session lifetime, after which no tokens are issued.
+func (a *Auth) tokenExpiry(app models.App, started time.Time, now time.Time) (access time.Time, refresh time.Time, err error) {
+	access = now.Add(a.appAccessTokenTTL(app))
+	refresh = now.Add(a.appRefreshTokenTTL(app))
+
+	if a.maxSessionLifetime <= 0 {
+		return access, refresh, nil
+	}
+
+	end := started.Add(a.maxSessionLifetime)
+	if !now.Before(end) {
+		return time.Time{}, time.Time{}, ErrSessionExpired
+	}
+	if access.After(end) {
+		access = end
+	}
+	if refresh.After(end) {
+		refresh = end
+	}
+
+	return access, refresh, nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/storage"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Logout revokes the presented access token together with the refresh
+// token family it was issued with.
+func (a *Auth) Logout(ctx context.Context, token string) error {
+	const op = "Auth.Logout"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("logging out")
+
+	familyID, err := a.authProvider.RevokeToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokensRevoked()
+
+	if familyID != "" {
+		if err := a.authProvider.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("logged out")
+
+	return nil
+}
+
+// LogoutAll revokes every token of the user who owns the presented token.
+func (a *Auth) LogoutAll(ctx context.Context, token string) error {
+	const op = "Auth.LogoutAll"
+
+	log := a.log.With(slog.String("op", op))
+
+	isAuthenticated, userID, err := a.authProvider.IsAuthenticated(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !isAuthenticated {
+		return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if err := a.authProvider.RevokeUserTokens(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokensRevoked()
+
+	log.Info("logged out of all sessions", slog.Int64("user_id", userID))
+
+	return nil
+}
+
+// RevokeUserTokens revokes every token of the given user. It is meant for
+// administrators; callers are responsible for checking permissions.
+func (a *Auth) RevokeUserTokens(ctx context.Context, userID int64) error {
+	const op = "Auth.RevokeUserTokens"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	if _, err := a.authProvider.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.RevokeUserTokens(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokensRevoked()
+
+	log.Info("revoked user tokens")
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+	other := login(t, a, "user@example.com", appID)
+
+	if err := a.Logout(ctx, pair.AccessToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if authenticated(t, a, pair.AccessToken) {
+		t.Errorf("access token accepted after logout")
+	}
+	if _, err := a.Refresh(ctx, pair.RefreshToken, appID); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Errorf("refresh after logout: got %v, want %v", err, auth.ErrInvalidRefreshToken)
+	}
+	if !authenticated(t, a, other.AccessToken) {
+		t.Errorf("logout revoked the tokens of another session")
+	}
+
+	if err := a.Logout(ctx, "not a token"); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("unknown token: got %v, want %v", err, auth.ErrInvalidToken)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+	registerUser(t, a, "other@example.com")
+
+	pairs := []string{
+		login(t, a, "user@example.com", appID).AccessToken,
+		login(t, a, "user@example.com", appID).AccessToken,
+	}
+	other := login(t, a, "other@example.com", appID)
+
+	if err := a.LogoutAll(ctx, pairs[0]); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+
+	for _, token := range pairs {
+		if authenticated(t, a, token) {
+			t.Errorf("access token accepted after logging out everywhere")
+		}
+	}
+	if !authenticated(t, a, other.AccessToken) {
+		t.Errorf("tokens of another user were revoked")
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	userID := registerUser(t, a, "user@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+
+	if err := a.RevokeUserTokens(ctx, userID); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+
+	if authenticated(t, a, pair.AccessToken) {
+		t.Errorf("access token accepted after revocation")
+	}
+	if _, err := a.Refresh(ctx, pair.RefreshToken, appID); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Errorf("refresh after revocation: got %v, want %v", err, auth.ErrInvalidRefreshToken)
+	}
+
+	if err := a.RevokeUserTokens(ctx, userID+1); !errors.Is(err, auth.ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want %v", err, auth.ErrUserNotFound)
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+)
+
+var (
+	ErrNotAppMember = errors.New("user is not a member of the app")
+	ErrAppNotFound  = errors.New("app not found")
+)
+
+// checkMembership makes sure the user may log in to the app. Users of apps
+// with open membership are enrolled on their first login.
+func (a *Auth) checkMembership(ctx context.Context, app models.App, userID int64) error {
+	isMember, err := a.authProvider.IsAppMember(ctx, app.ID, userID)
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return nil
+	}
+
+	if !app.OpenMembership {
+		return ErrNotAppMember
+	}
+
+	a.log.Info("enrolling user in app", slog.Int("app_id", app.ID), slog.Int64("user_id", userID))
+
+	return a.authProvider.AddAppMember(ctx, app.ID, userID)
+}
+
+func (a *Auth) AddAppMember(ctx context.Context, appID int, userID int64) error {
+	const op = "Auth.AddAppMember"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int64("user_id", userID),
+	)
+
+	if _, err := a.authProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := a.authProvider.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.AddAppMember(ctx, appID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app member added")
+
+	return nil
+}
+
+// RemoveAppMember removes the user from the app, revokes the access and
+// refresh tokens issued for it and ends the sessions of the user in it.
+func (a *Auth) RemoveAppMember(ctx context.Context, appID int, userID int64) error {
+	const op = "Auth.RemoveAppMember"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int64("user_id", userID),
+	)
+
+	if err := a.authProvider.RemoveAppMember(ctx, appID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokensRevoked()
+
+	log.Info("app member removed")
+
+	return nil
+}
+
+func (a *Auth) AssignAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	const op = "Auth.AssignAppRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int64("user_id", userID),
+		slog.String("role", role),
+	)
+
+	if err := a.authProvider.AssignAppRole(ctx, appID, userID, role); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotAppMember):
+			return fmt.Errorf("%s: %w", op, ErrNotAppMember)
+		case errors.Is(err, storage.ErrRoleNotFound):
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app role assigned")
+
+	return nil
+}
+
+func (a *Auth) RevokeAppRole(ctx context.Context, appID int, userID int64, role string) error {
+	const op = "Auth.RevokeAppRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+		slog.Int64("user_id", userID),
+		slog.String("role", role),
+	)
+
+	if err := a.authProvider.RevokeAppRole(ctx, appID, userID, role); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app role revoked")
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRemoveAppMemberRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	userID := registerUser(t, a, "user@example.com")
+	registerUser(t, a, "other@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+	other := login(t, a, "other@example.com", appID)
+
+	if err := a.RemoveAppMember(ctx, appID, userID); err != nil {
+		t.Fatalf("RemoveAppMember: %v", err)
+	}
+
+	if authenticated(t, a, pair.AccessToken) {
+		t.Errorf("access token accepted after removing the user from the app")
+	}
+	if _, err := a.Refresh(ctx, pair.RefreshToken, appID); err == nil {
+		t.Errorf("refresh token accepted after removing the user from the app")
+	}
+
+	sessions, err := a.ListSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("sessions kept after removing the user from the app: %+v", sessions)
+	}
+
+	if !authenticated(t, a, other.AccessToken) {
+		t.Errorf("access token of another member rejected")
+	}
+}
@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/clientinfo"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"sso/internal/totp"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrMFARequired       = errors.New("two-factor authentication code required")
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrMFADisabled       = errors.New("two-factor authentication is not configured")
+)
+
+// SecretBox encrypts secrets that are stored in a readable form.
+type SecretBox interface {
+	Seal(plaintext []byte) (string, error)
+	Open(value string) ([]byte, error)
+}
+
+// EnrollTOTP starts TOTP enrollment for the user and returns the secret
+// together with its otpauth:// URI. Two-factor authentication is enabled
+// only once ConfirmTOTP accepts a first code.
+func (a *Auth) EnrollTOTP(ctx context.Context, userID int64) (secret string, uri string, err error) {
+	const op = "Auth.EnrollTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	if a.mfaSecrets == nil {
+		return "", "", fmt.Errorf("%s: %w", op, ErrMFADisabled)
+	}
+
+	enabled, err := a.mfaEnabled(ctx, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	if enabled {
+		return "", "", fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	user, err := a.authProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	sealed, err := a.mfaSecrets.Seal([]byte(secret))
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.SaveTOTP(ctx, userID, sealed); err != nil {
+		log.Error("failed to save totp secret", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enrollment started")
+
+	return secret, totp.URI(a.mfaIssuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves the
+// authenticator works, and returns one-time recovery codes. They are shown
+// only here; the server keeps their hashes.
+func (a *Auth) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	const op = "Auth.ConfirmTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	enrollment, err := a.authProvider.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMFANotEnrolled)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if enrollment.Confirmed {
+		return nil, fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	secret, err := a.totpSecret(enrollment)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	counter, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidMFACode)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	stored := make([]string, len(codes))
+	for i, c := range codes {
+		stored[i] = normalizeRecoveryCode(c)
+	}
+
+	if err := a.authProvider.ConfirmTOTP(ctx, userID, counter, stored); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("two-factor authentication enabled")
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It takes a current code
+// or a recovery code so a stolen access token alone cannot disable it, and
+// wrong codes count as failed logins of the user.
+func (a *Auth) DisableTOTP(ctx context.Context, userID int64, code string) error {
+	const op = "Auth.DisableTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	user, err := a.authProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkSecondFactor(ctx, log, user, code); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.loginSucceeded(ctx, log, user.Email)
+
+	if err := a.authProvider.DeleteTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("two-factor authentication disabled")
+
+	return nil
+}
+
+// VerifyMFA completes a login that returned an MFA token. code is a TOTP
+// code or a recovery code. The MFA token is single use: a wrong code
+// consumes it and the user has to log in again.
+func (a *Auth) VerifyMFA(ctx context.Context, mfaToken string, code string, appID int) (models.TokenPair, error) {
+	const op = "Auth.VerifyMFA"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	userID, err := a.authProvider.ConsumeToken(ctx, mfaToken, storage.ScopeMFA)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.authProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkSecondFactor(ctx, log, user, code); err != nil {
+		log.Warn("second factor rejected", slog.Int64("user_id", userID), sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	a.loginSucceeded(ctx, log, user.Email)
+
+	app, err := a.app(ctx, appID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkMembership(ctx, app, user.ID); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := a.issueTokens(ctx, user, app, "", "")
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with second factor", slog.Int64("user_id", user.ID))
+
+	return pair, nil
+}
+
+// mfaChallenge issues the MFA token that Login returns instead of access
+// tokens to users with two-factor authentication enabled.
+func (a *Auth) mfaChallenge(ctx context.Context, userID int64) (models.TokenPair, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	err = a.authProvider.SaveScopedToken(ctx, token, userID, storage.ScopeMFA, time.Now().Add(a.mfaChallengeTTL))
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{MFAToken: token}, nil
+}
+
+func (a *Auth) mfaEnabled(ctx context.Context, userID int64) (bool, error) {
+	enrollment, err := a.authProvider.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return enrollment.Confirmed, nil
+}
+
+// checkSecondFactor verifies the TOTP or recovery code of the user under
+// the same lockout as passwords: it is refused while the account or the
+// client address is blocked, and a wrong code counts as a failed login.
+func (a *Auth) checkSecondFactor(ctx context.Context, log *slog.Logger, user models.User, code string) error {
+	ip := clientinfo.FromContext(ctx).IP
+
+	if a.lockout != nil {
+		if err := a.lockout.Check(ctx, user.Email, ip); err != nil {
+			log.Warn("second factor attempt refused", slog.String("ip", ip), sl.Err(err))
+
+			return err
+		}
+	}
+
+	err := a.verifyMFACode(ctx, user.ID, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		a.loginFailed(ctx, log, user.Email, ip)
+	}
+
+	return err
+}
+
+// totpSecret decrypts the TOTP secret of the enrollment. TOTP secrets are
+// never stored without an encryption key, so without one TOTP codes are
+// refused; recovery codes keep working.
+func (a *Auth) totpSecret(enrollment models.TOTP) ([]byte, error) {
+	if a.mfaSecrets == nil {
+		return nil, ErrMFADisabled
+	}
+
+	return a.mfaSecrets.Open(enrollment.Secret)
+}
+
+// verifyMFACode accepts a TOTP code that was not used before or an unused
+// recovery code.
+func (a *Auth) verifyMFACode(ctx context.Context, userID int64, code string) error {
+	enrollment, err := a.authProvider.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return ErrMFANotEnrolled
+		}
+
+		return err
+	}
+	if !enrollment.Confirmed {
+		return ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		secret, err := a.totpSecret(enrollment)
+		if err != nil {
+			return err
+		}
+
+		counter, ok := totp.Validate(string(secret), code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		ok, err = a.authProvider.UseTOTPCounter(ctx, userID, counter)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		return nil
+	}
+
+	ok, err := a.authProvider.UseRecoveryCode(ctx, userID, normalizeRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// newRecoveryCode returns a code like "abcde-fghij".
+func newRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 8)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))[:10]
+
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,388 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"strings"
+	"time"
+)
+
+const CodeChallengeS256 = "S256"
+
+var (
+	ErrInvalidClient       = errors.New("invalid client")
+	ErrInvalidRedirectURI  = errors.New("invalid redirect uri")
+	ErrInvalidGrant        = errors.New("invalid grant")
+	ErrInvalidRequest      = errors.New("invalid request")
+	ErrAccessDenied        = errors.New("access denied")
+	ErrInvalidConsentToken = errors.New("invalid or expired consent token")
+)
+
+// consentTokenTTL is how long the user has to decide on the consent page
+// after signing in.
+const consentTokenTTL = 10 * time.Minute
+
+// AuthorizeRequest holds the parameters of an OAuth2 authorization request.
+type AuthorizeRequest struct {
+	ClientID            int
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// ValidateAuthorizeRequest checks the client and its redirect URI. Errors
+// other than ErrInvalidClient and ErrInvalidRedirectURI may be reported back
+// to the redirect URI.
+func (a *Auth) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (models.App, error) {
+	const op = "Auth.ValidateAuthorizeRequest"
+
+	app, err := a.authProvider.App(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.Secret = ""
+
+	if !slices.Contains(app.RedirectURIs, req.RedirectURI) {
+		return models.App{}, fmt.Errorf("%s: %w", op, ErrInvalidRedirectURI)
+	}
+
+	if req.CodeChallenge == "" && app.ClientType == models.ClientTypePublic {
+		return app, fmt.Errorf("%s: %w: public clients must use PKCE", op, ErrInvalidRequest)
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != CodeChallengeS256 {
+		return app, fmt.Errorf("%s: %w: unsupported code challenge method", op, ErrInvalidRequest)
+	}
+
+	return app, nil
+}
+
+// Authorize authenticates the user and issues an authorization code. Users
+// with two-factor authentication enabled must also pass a TOTP or recovery
+// code. When the user has not consented to the requested scope yet, no code
+// is issued; instead the returned consent token lets Consent complete the
+// request once the user decides.
+func (a *Auth) Authorize(
+	ctx context.Context,
+	req AuthorizeRequest,
+	email string,
+	password string,
+	mfaCode string,
+) (code string, consentToken string, err error) {
+	const op = "Auth.Authorize"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", req.ClientID),
+	)
+
+	if _, err := a.ValidateAuthorizeRequest(ctx, req); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.authenticateUser(ctx, log, email, password)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	mfaEnabled, err := a.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	if mfaEnabled {
+		if mfaCode == "" {
+			return "", "", fmt.Errorf("%s: %w", op, ErrMFARequired)
+		}
+		if err := a.checkSecondFactor(ctx, log, user, mfaCode); err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	a.loginSucceeded(ctx, log, email)
+
+	app, err := a.app(ctx, req.ClientID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkMembership(ctx, app, user.ID); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	granted, ok, err := a.authProvider.ConsentScope(ctx, user.ID, app.ID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !ok || !scopesCovered(granted, req.Scope) {
+		consentToken, err := newOpaqueToken()
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		expiry := time.Now().Add(consentTokenTTL)
+		if err := a.authProvider.SaveScopedToken(ctx, consentToken, user.ID, consentScope(app.ID), expiry); err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("consent required", slog.Int64("user_id", user.ID))
+
+		return "", consentToken, nil
+	}
+
+	code, err = a.issueAuthorizationCode(ctx, req, user.ID)
+	if err != nil {
+		log.Error("failed to issue authorization code", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code issued", slog.Int64("user_id", user.ID))
+
+	return code, "", nil
+}
+
+// Consent completes an authorization request that Authorize returned a
+// consent token for. allow is the decision of the user: when set, the
+// requested scope is recorded as granted and an authorization code issued,
+// otherwise ErrAccessDenied is returned. The consent token is single use
+// and only valid for the client it was issued for.
+func (a *Auth) Consent(ctx context.Context, req AuthorizeRequest, consentToken string, allow bool) (string, error) {
+	const op = "Auth.Consent"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", req.ClientID),
+	)
+
+	if _, err := a.ValidateAuthorizeRequest(ctx, req); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	userID, err := a.authProvider.ConsumeToken(ctx, consentToken, consentScope(req.ClientID))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("consent token not found")
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidConsentToken)
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !allow {
+		log.Info("consent denied", slog.Int64("user_id", userID))
+
+		return "", fmt.Errorf("%s: %w", op, ErrAccessDenied)
+	}
+
+	granted, _, err := a.authProvider.ConsentScope(ctx, userID, req.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.SaveConsent(ctx, userID, req.ClientID, mergeScopes(granted, req.Scope)); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := a.issueAuthorizationCode(ctx, req, userID)
+	if err != nil {
+		log.Error("failed to issue authorization code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("consent granted, authorization code issued", slog.Int64("user_id", userID))
+
+	return code, nil
+}
+
+func (a *Auth) issueAuthorizationCode(ctx context.Context, req AuthorizeRequest, userID int64) (string, error) {
+	code, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.authProvider.SaveAuthorizationCode(ctx, code, models.AuthorizationCode{
+		AppID:               req.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		Expiry:              time.Now().Add(a.authorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// consentScope is the token scope of consent tokens for the app, which
+// binds them to the client they were issued for.
+func consentScope(appID int) string {
+	return fmt.Sprintf("%s:%d", storage.ScopeConsent, appID)
+}
+
+// ExchangeCode redeems an authorization code for a token pair. It returns
+// the scope the code was issued for.
+func (a *Auth) ExchangeCode(
+	ctx context.Context,
+	clientID int,
+	clientSecret string,
+	code string,
+	redirectURI string,
+	codeVerifier string,
+) (models.TokenPair, string, error) {
+	const op = "Auth.ExchangeCode"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", clientID),
+	)
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authCode, err := a.authProvider.ConsumeAuthorizationCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("authorization code not found")
+			return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+
+		return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if authCode.AppID != app.ID || authCode.RedirectURI != redirectURI {
+		log.Warn("authorization code issued for another client or redirect uri")
+		return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	if !verifyCodeChallenge(authCode.CodeChallenge, codeVerifier) {
+		log.Warn("code verifier does not match")
+		return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	user, err := a.authProvider.GetUserByID(ctx, authCode.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+
+		return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := a.issueTokens(ctx, user, app, "", authCode.Scope)
+	if err != nil {
+		return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if slices.Contains(strings.Fields(authCode.Scope), ScopeOpenID) {
+		keys, err := a.appKeys(ctx, app)
+		if err != nil {
+			return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		pair.IDToken, err = NewIDToken(user, app, keys.Active(), a.issuer, authCode.Scope, authCode.Nonce, a.appAccessTokenTTL(app))
+		if err != nil {
+			log.Error("failed to generate id token", sl.Err(err))
+
+			return models.TokenPair{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("authorization code exchanged", slog.Int64("user_id", user.ID))
+
+	return pair, authCode.Scope, nil
+}
+
+// RefreshClient is Refresh for OAuth2 clients, which authenticate first.
+func (a *Auth) RefreshClient(ctx context.Context, clientID int, clientSecret string, refreshToken string) (models.TokenPair, error) {
+	const op = "Auth.RefreshClient"
+
+	if _, err := a.authenticateClient(ctx, clientID, clientSecret); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := a.Refresh(ctx, refreshToken, clientID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidGrant, err)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pair, nil
+}
+
+// authenticateClient checks the secret of confidential clients. Public
+// clients are identified by their id alone.
+func (a *Auth) authenticateClient(ctx context.Context, clientID int, clientSecret string) (models.App, error) {
+	app, err := a.app(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, ErrInvalidClient
+		}
+
+		return models.App{}, err
+	}
+
+	if app.ClientType != models.ClientTypePublic &&
+		subtle.ConstantTimeCompare([]byte(clientSecret), []byte(app.Secret)) != 1 {
+		return models.App{}, ErrInvalidClient
+	}
+
+	return app, nil
+}
+
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func scopesCovered(granted string, requested string) bool {
+	have := strings.Fields(granted)
+	for _, s := range strings.Fields(requested) {
+		if !slices.Contains(have, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeScopes(granted string, requested string) string {
+	scopes := strings.Fields(granted)
+	for _, s := range strings.Fields(requested) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	slices.Sort(scopes)
+
+	return strings.Join(scopes, " ")
+}
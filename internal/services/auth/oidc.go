@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"sso/internal/domain/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+// UserInfo holds the standard OpenID Connect claims about a user.
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+}
+
+// NewUserInfo returns the claims of the user that the scope grants access
+// to. An empty scope grants all of them.
+func NewUserInfo(user models.User, scope string) UserInfo {
+	scopes := strings.Fields(scope)
+	all := len(scopes) == 0
+
+	info := UserInfo{Subject: strconv.FormatInt(user.ID, 10)}
+	if all || slices.Contains(scopes, ScopeEmail) {
+		activated := user.Activated
+		info.Email = user.Email
+		info.EmailVerified = &activated
+	}
+	if all || slices.Contains(scopes, ScopeProfile) {
+		info.GivenName = user.Fname
+		info.FamilyName = user.Lname
+	}
+
+	return info
+}
+
+// NewIDToken signs an OpenID Connect ID token for the app. It is signed like
+// access tokens, so HS256 ID tokens use the client secret as OIDC requires.
+func NewIDToken(
+	user models.User,
+	app models.App,
+	key *SigningKey,
+	issuer string,
+	scope string,
+	nonce string,
+	duration time.Duration,
+) (string, error) {
+	method := jwt.SigningMethod(jwt.SigningMethodHS256)
+	var signingKey any = []byte(app.Secret)
+	if key != nil {
+		method = key.method()
+		signingKey = key.signingKey()
+	}
+
+	now := time.Now()
+	info := NewUserInfo(user, scope)
+
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"sub": info.Subject,
+		"aud": strconv.Itoa(app.ID),
+		"iat": now.Unix(),
+		"exp": now.Add(duration).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if info.Email != "" {
+		claims["email"] = info.Email
+		claims["email_verified"] = *info.EmailVerified
+	}
+	if info.GivenName != "" {
+		claims["given_name"] = info.GivenName
+	}
+	if info.FamilyName != "" {
+		claims["family_name"] = info.FamilyName
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if key != nil {
+		token.Header["kid"] = key.ID
+	}
+
+	return token.SignedString(signingKey)
+}
+
+// Issuer is the OpenID Connect issuer identifier.
+func (a *Auth) Issuer() string {
+	return a.issuer
+}
+
+// SigningAlgorithm is the algorithm access and ID tokens are signed with:
+// the one of the active global key, or HS256 with the client secret when
+// no key is configured.
+func (a *Auth) SigningAlgorithm() string {
+	if key := a.keys.Active(); key != nil {
+		return key.Algorithm
+	}
+
+	return AlgHS256
+}
+
+// UserInfoClaims authenticates the access token of a userinfo request and
+// returns its claims. The claims about the user come from the user service;
+// the scope of the token decides which of them are returned. Client
+// credentials tokens act for no user and are rejected.
+func (a *Auth) UserInfoClaims(ctx context.Context, token string) (*TokenClaims, error) {
+	const op = "Auth.UserInfoClaims"
+
+	claims, err := a.VerifyToken(ctx, token)
+	if err != nil || claims.UID == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	isAuthenticated, _, err := a.authProvider.IsAuthenticated(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !isAuthenticated {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
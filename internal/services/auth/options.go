@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"sso/internal/domain/models"
+	"sso/internal/lockout"
+	"sso/internal/password"
+	"time"
+)
+
+// Mailer delivers account emails such as activation links.
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// SecretOpener decrypts app secrets that are stored encrypted.
+type SecretOpener interface {
+	Open(value string) ([]byte, error)
+}
+
+type Option func(*Auth)
+
+func WithMailer(mailer Mailer) Option {
+	return func(a *Auth) {
+		a.mailer = mailer
+	}
+}
+
+// WithActivation sets the lifetime of activation tokens and whether users
+// must activate their account before they can log in.
+func WithActivation(requireForLogin bool, tokenTTL time.Duration) Option {
+	return func(a *Auth) {
+		a.requireActivation = requireForLogin
+		a.activationTokenTTL = tokenTTL
+	}
+}
+
+func WithPasswordReset(tokenTTL time.Duration) Option {
+	return func(a *Auth) {
+		a.passwordResetTokenTTL = tokenTTL
+	}
+}
+
+func WithAppSecrets(secrets SecretOpener) Option {
+	return func(a *Auth) {
+		a.appSecrets = secrets
+	}
+}
+
+// WithSigningKeySecrets seals the private keys of app key rings with
+// secrets before they are stored.
+func WithSigningKeySecrets(secrets SecretBox) Option {
+	return func(a *Auth) {
+		a.keySecrets = secrets
+	}
+}
+
+// WithOAuth configures the OAuth2 authorization server. issuer identifies
+// the server in OpenID Connect ID tokens.
+func WithOAuth(authorizationCodeTTL time.Duration, issuer string) Option {
+	return func(a *Auth) {
+		a.authorizationCodeTTL = authorizationCodeTTL
+		a.issuer = issuer
+	}
+}
+
+// WithMFA configures two-factor authentication. issuer labels the account
+// in authenticator apps, and TOTP secrets are sealed with secrets.
+func WithMFA(issuer string, challengeTTL time.Duration, secrets SecretBox) Option {
+	return func(a *Auth) {
+		a.mfaIssuer = issuer
+		a.mfaChallengeTTL = challengeTTL
+		a.mfaSecrets = secrets
+	}
+}
+
+// WithWebAuthn enables passkey registration and login. sessionTTL bounds
+// the time between the begin and finish steps of a ceremony.
+func WithWebAuthn(w *webauthn.WebAuthn, sessionTTL time.Duration) Option {
+	return func(a *Auth) {
+		a.webAuthn = w
+		a.webAuthnSessionTTL = sessionTTL
+
+		// Keys the made up passkeys of unknown emails, see
+		// decoyWebAuthnUser. It only has to be stable for the process.
+		a.webAuthnDecoyKey = make([]byte, 32)
+		if _, err := rand.Read(a.webAuthnDecoyKey); err != nil {
+			panic(fmt.Sprintf("webauthn decoy key: %v", err))
+		}
+	}
+}
+
+// WithLockout throttles failed password logins.
+func WithLockout(limiter *lockout.Limiter) Option {
+	return func(a *Auth) {
+		a.lockout = limiter
+	}
+}
+
+// WithPasswordPolicy sets the policy new passwords are checked against.
+// By default only passwords bcrypt cannot hash are rejected.
+func WithPasswordPolicy(policy *password.Policy) Option {
+	return func(a *Auth) {
+		a.passwords = policy
+	}
+}
+
+// WithPasswordHasher sets how new passwords are hashed. Stored hashes of
+// other algorithms or weaker parameters are replaced on the next login.
+func WithPasswordHasher(hasher models.PasswordHasher) Option {
+	return func(a *Auth) {
+		a.hasher = hasher
+	}
+}
+
+// WithMaxSessionLifetime limits how long a login can be kept alive by
+// refreshing. Tokens never outlive the session; zero means no limit.
+func WithMaxSessionLifetime(d time.Duration) Option {
+	return func(a *Auth) {
+		a.maxSessionLifetime = d
+	}
+}
+
+// WithTokenVerification selects how IsAuthenticated checks access tokens;
+// see VerificationStateful, VerificationStateless and VerificationHybrid.
+// App keys and the revocation list are reloaded every refresh. Without the
+// database lookup, session activity is only recorded when tokens are
+// refreshed.
+func WithTokenVerification(mode string, refresh time.Duration) Option {
+	return func(a *Auth) {
+		if mode == VerificationStateful {
+			a.verifier = nil
+			return
+		}
+		a.verifier = newTokenVerifier(mode, refresh)
+	}
+}
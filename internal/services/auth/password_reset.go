@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("invalid password reset token")
+
+// RequestPasswordReset mails a password reset token to the user. It reports
+// success for unknown emails too, and creates and mails the token in the
+// background, so callers can probe for accounts neither by the result nor
+// by the response time.
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	const op = "Auth.RequestPasswordReset"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.authProvider.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("password reset requested for unknown email")
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	go func() {
+		if err := a.sendPasswordResetToken(context.WithoutCancel(ctx), user); err != nil {
+			log.Error("failed to send password reset token", slog.Int64("user_id", user.ID), sl.Err(err))
+			return
+		}
+
+		log.Info("password reset requested", slog.Int64("user_id", user.ID))
+	}()
+
+	return nil
+}
+
+// sendPasswordResetToken replaces any pending reset token of the user with
+// a new one and mails it.
+func (a *Auth) sendPasswordResetToken(ctx context.Context, user models.User) error {
+	if err := a.authProvider.DeleteScopedTokens(ctx, user.ID, storage.ScopePasswordReset); err != nil {
+		return err
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	expiry := time.Now().Add(a.passwordResetTokenTTL)
+	if err := a.authProvider.SaveScopedToken(ctx, token, user.ID, storage.ScopePasswordReset, expiry); err != nil {
+		return err
+	}
+
+	if a.mailer == nil {
+		a.log.Warn("no mailer configured, password reset token not sent", slog.Int64("user_id", user.ID))
+		return nil
+	}
+
+	body := fmt.Sprintf(
+		"Use the following token to reset your password:\n\n%s\n\nThe token expires at %s. "+
+			"If you did not request a password reset, you can ignore this email.\n",
+		token, expiry.Format(time.RFC1123),
+	)
+
+	return a.mailer.Send(ctx, user.Email, "Reset your password", body)
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes
+// every existing session of the user.
+func (a *Auth) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	const op = "Auth.ResetPassword"
+
+	log := a.log.With(slog.String("op", op))
+
+	// The token is consumed only once the password is accepted, so a
+	// rejected password does not cost the user the reset link.
+	userID, err := a.authProvider.ScopedTokenUser(ctx, token, storage.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("password reset token not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.authProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.passwords.Validate(newPassword, user.Email, user.Fname, user.Lname); err != nil {
+		log.Info("password rejected", slog.Int64("user_id", userID), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.authProvider.ConsumeToken(ctx, token, storage.ScopePasswordReset); err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := user.PasswordHash.Set(newPassword, a.hasher); err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.UpdatePassword(ctx, userID, user.PasswordHash.Hash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.DeleteScopedTokens(ctx, userID, storage.ScopePasswordReset); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.authProvider.RevokeUserTokens(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokensRevoked()
+
+	log.Info("password reset", slog.Int64("user_id", userID))
+
+	return nil
+}
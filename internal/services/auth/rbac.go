@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"strings"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// withAccess loads the roles and permissions that go into the user's tokens
+// for the app.
+func (a *Auth) withAccess(ctx context.Context, user models.User, appID int) (models.User, error) {
+	roles, err := a.authProvider.UserRoles(ctx, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	permissions, err := a.authProvider.UserPermissions(ctx, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	appRoles, err := a.authProvider.AppRoles(ctx, appID, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user.Roles = roles
+	user.Permissions = permissions
+	user.AppRoles = appRoles
+
+	return user, nil
+}
+
+// scopedPermissions returns the permissions that are also granted by the
+// scope. OAuth clients act for the user only within the consented scope, so
+// their tokens must not carry the full permissions of the user.
+func scopedPermissions(permissions []string, scope string) []string {
+	granted := strings.Fields(scope)
+
+	var scoped []string
+	for _, permission := range permissions {
+		if slices.Contains(granted, permission) {
+			scoped = append(scoped, permission)
+		}
+	}
+
+	return scoped
+}
+
+func (a *Auth) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	const op = "Auth.UserRoles"
+
+	roles, err := a.authProvider.UserRoles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (a *Auth) UserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	const op = "Auth.UserPermissions"
+
+	permissions, err := a.authProvider.UserPermissions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+func (a *Auth) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	const op = "Auth.HasPermission"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("permission", permission),
+	)
+
+	has, err := a.authProvider.HasPermission(ctx, userID, permission)
+	if err != nil {
+		log.Error("failed to check permission", sl.Err(err))
+
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("checked permission", slog.Bool("has_permission", has))
+
+	return has, nil
+}
+
+// AssignRole grants the role to the user. Callers are responsible for
+// checking that the caller may manage roles.
+func (a *Auth) AssignRole(ctx context.Context, userID int64, role string) error {
+	const op = "Auth.AssignRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("role", role),
+	)
+
+	if err := a.authProvider.AssignRole(ctx, userID, role); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role assigned")
+
+	return nil
+}
+
+func (a *Auth) RevokeRole(ctx context.Context, userID int64, role string) error {
+	const op = "Auth.RevokeRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("role", role),
+	)
+
+	if err := a.authProvider.RevokeRole(ctx, userID, role); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role revoked")
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/clientinfo"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// Refresh exchanges a refresh token for a new token pair. Refresh tokens are
+// single use: presenting one a second time revokes its whole family,
+// including the access tokens issued with it, so a stolen token stops
+// working for both the thief and the legitimate client.
+func (a *Auth) Refresh(ctx context.Context, refreshToken string, appID int) (models.TokenPair, error) {
+	const op = "Auth.Refresh"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	log.Info("refreshing token")
+
+	rt, err := a.authProvider.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("refresh token not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rt.Revoked || rt.AppID != appID || time.Now().After(rt.Expiry) {
+		log.Warn("refresh token is not valid", slog.Int64("user_id", rt.UserID))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+	}
+
+	used := rt.Used
+	if !used {
+		ok, err := a.authProvider.UseRefreshToken(ctx, refreshToken)
+		if err != nil {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+		used = !ok
+	}
+
+	if used {
+		log.Warn("refresh token reuse detected, revoking family",
+			slog.Int64("user_id", rt.UserID),
+			slog.String("family_id", rt.FamilyID),
+		)
+
+		if err := a.authProvider.RevokeRefreshTokenFamily(ctx, rt.FamilyID); err != nil {
+			log.Error("failed to revoke token family", sl.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+		a.tokensRevoked()
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrRefreshTokenReused)
+	}
+
+	user, err := a.authProvider.GetUserByID(ctx, rt.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.app(ctx, appID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkMembership(ctx, app, user.ID); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := a.issueTokens(ctx, user, app, rt.FamilyID, "")
+	if err != nil {
+		if errors.Is(err, ErrSessionExpired) {
+			log.Info("session reached its maximum lifetime", slog.Int64("user_id", user.ID))
+
+			if err := a.authProvider.RevokeRefreshTokenFamily(ctx, rt.FamilyID); err != nil {
+				log.Error("failed to revoke token family", sl.Err(err))
+			}
+			a.tokensRevoked()
+
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("token refreshed", slog.Int64("user_id", user.ID))
+
+	return pair, nil
+}
+
+// issueTokens signs a new access token and creates a refresh token in the
+// given family. An empty familyID starts a new family, and with it a new
+// session granted scope; tokens of an existing family keep the scope of
+// its session. Scoped tokens only carry the permissions named in the scope.
+func (a *Auth) issueTokens(ctx context.Context, user models.User, app models.App, familyID string, scope string) (models.TokenPair, error) {
+	user, err := a.withAccess(ctx, user, app.ID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	keys, err := a.appKeys(ctx, app)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	now := time.Now()
+	started := now
+
+	if familyID == "" {
+		familyID, err = newFamilyID()
+		if err != nil {
+			return models.TokenPair{}, err
+		}
+	} else {
+		session, err := a.authProvider.Session(ctx, familyID)
+		switch {
+		case err == nil:
+			started = session.CreatedAt
+			scope = session.Scope
+		case !errors.Is(err, storage.ErrSessionNotFound):
+			return models.TokenPair{}, err
+		}
+	}
+
+	if scope != "" {
+		user.Permissions = scopedPermissions(user.Permissions, scope)
+	}
+
+	accessExpiry, refreshExpiry, err := a.tokenExpiry(app, started, now)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	id, err := newFamilyID()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	accessToken, err := NewToken(user, app, keys.Active(), id, scope, now, accessExpiry)
+	if err != nil {
+		a.log.Error("failed to generate token", sl.Err(err))
+
+		return models.TokenPair{}, err
+	}
+
+	isSaved, err := a.authProvider.SaveToken(ctx, accessToken, user.ID, familyID, accessExpiry)
+	if err != nil {
+		a.log.Warn("token not saved", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+	if !isSaved {
+		return models.TokenPair{}, storage.ErrTokenNotSaved
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	err = a.authProvider.SaveRefreshToken(ctx, refreshToken, user.ID, app.ID, familyID, refreshExpiry)
+	if err != nil {
+		a.log.Warn("refresh token not saved", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	client := clientinfo.FromContext(ctx)
+	err = a.authProvider.SaveSession(ctx, models.Session{
+		ID:        familyID,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Expiry:    refreshExpiry,
+		Scope:     scope,
+	})
+	if err != nil {
+		a.log.Warn("session not saved", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    accessExpiry.Sub(now),
+	}, nil
+}
+
+func newOpaqueToken() (string, error) {
+	randomBytes := make([]byte, 32)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+func newFamilyID() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,71 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+
+	refreshed, err := a.Refresh(ctx, pair.RefreshToken, appID)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.RefreshToken == pair.RefreshToken || refreshed.AccessToken == pair.AccessToken {
+		t.Fatalf("Refresh returned the tokens it was given")
+	}
+	if !authenticated(t, a, refreshed.AccessToken) {
+		t.Errorf("refreshed access token not accepted")
+	}
+
+	if _, err := a.Refresh(ctx, refreshed.RefreshToken, appID); err != nil {
+		t.Errorf("Refresh with the rotated token: %v", err)
+	}
+}
+
+func TestRefreshDetectsReuse(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+	refreshed, err := a.Refresh(ctx, pair.RefreshToken, appID)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Someone presents the rotated token again: the whole family is revoked.
+	_, err = a.Refresh(ctx, pair.RefreshToken, appID)
+	if !errors.Is(err, auth.ErrRefreshTokenReused) {
+		t.Fatalf("reused refresh token: got %v, want %v", err, auth.ErrRefreshTokenReused)
+	}
+
+	_, err = a.Refresh(ctx, refreshed.RefreshToken, appID)
+	if !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Errorf("refresh token of revoked family: got %v, want %v", err, auth.ErrInvalidRefreshToken)
+	}
+	for _, token := range []string{pair.AccessToken, refreshed.AccessToken} {
+		if authenticated(t, a, token) {
+			t.Errorf("access token of revoked family still accepted")
+		}
+	}
+}
+
+func TestRefreshRejectsOtherApp(t *testing.T) {
+	a, appID := newTestAuth(t)
+	registerUser(t, a, "user@example.com")
+
+	pair := login(t, a, "user@example.com", appID)
+
+	_, err := a.Refresh(context.Background(), pair.RefreshToken, appID+1)
+	if !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, auth.ErrInvalidRefreshToken)
+	}
+}
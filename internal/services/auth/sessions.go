@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions returns the active sessions of the user, most recently seen
+// first.
+func (a *Auth) ListSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "Auth.ListSessions"
+
+	sessions, err := a.authProvider.Sessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs the user out of one session, revoking its access and
+// refresh tokens.
+func (a *Auth) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "Auth.RevokeSession"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	if err := a.authProvider.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokensRevoked()
+
+	log.Info("session revoked")
+
+	return nil
+}
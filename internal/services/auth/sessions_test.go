@@ -0,0 +1,81 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	userID := registerUser(t, a, "user@example.com")
+	registerUser(t, a, "other@example.com")
+
+	login(t, a, "user@example.com", appID)
+	pair := login(t, a, "user@example.com", appID)
+	login(t, a, "other@example.com", appID)
+
+	// Refreshing stays in the session instead of starting another one.
+	if _, err := a.Refresh(ctx, pair.RefreshToken, appID); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	sessions, err := a.ListSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.UserID != userID || session.AppID != appID {
+			t.Errorf("session %+v of another user or app", session)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newTestAuth(t)
+	userID := registerUser(t, a, "user@example.com")
+	otherID := registerUser(t, a, "other@example.com")
+
+	pairs := []string{
+		login(t, a, "user@example.com", appID).AccessToken,
+		login(t, a, "user@example.com", appID).AccessToken,
+	}
+
+	sessions, err := a.ListSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	sessionID := sessions[0].ID
+
+	if err := a.RevokeSession(ctx, otherID, sessionID); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("revoking the session of another user: got %v, want %v", err, auth.ErrSessionNotFound)
+	}
+	if err := a.RevokeSession(ctx, userID, sessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	sessions, err = a.ListSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID == sessionID {
+		t.Errorf("sessions after revoking %s: %+v", sessionID, sessions)
+	}
+
+	// Only the access token of the revoked session stops working.
+	accepted := 0
+	for _, token := range pairs {
+		if authenticated(t, a, token) {
+			accepted++
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("%d of 2 access tokens accepted after revoking one session, want 1", accepted)
+	}
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"sync"
+	"time"
+)
+
+// Verification modes of IsAuthenticated.
+const (
+	// VerificationStateful looks every token up in the database, so
+	// revocations apply immediately.
+	VerificationStateful = "stateful"
+	// VerificationStateless only checks the signature, expiry and app of the
+	// token. Revoked tokens stay valid until they expire.
+	VerificationStateless = "stateless"
+	// VerificationHybrid checks the token like VerificationStateless and
+	// then against a list of revoked tokens that is reloaded periodically.
+	VerificationHybrid = "hybrid"
+)
+
+// keyReloadInterval limits how often tokens with an unknown kid reload the
+// keys of their app, so forged tokens cannot hammer the database.
+const keyReloadInterval = 10 * time.Second
+
+// tokenVerifier holds what stateless and hybrid verification need in
+// memory: the verification keys of apps and the revocation list. Both are
+// reloaded when they are older than refresh.
+type tokenVerifier struct {
+	mode    string
+	refresh time.Duration
+
+	appsMu sync.Mutex
+	apps   map[int]appVerificationKeys
+
+	// loading serialises reloads of the revocation list. Requests that find
+	// the list stale while another one reloads it use the old list.
+	loading   sync.Mutex
+	revokedMu sync.RWMutex
+	revoked   map[[sha256.Size]byte]struct{}
+	loadedAt  time.Time
+	// revokedAt is when this instance last revoked tokens. A list loaded
+	// before then may miss them and is reloaded on the next check.
+	revokedAt time.Time
+}
+
+type appVerificationKeys struct {
+	secret   string
+	keys     *KeySet
+	loadedAt time.Time
+}
+
+func newTokenVerifier(mode string, refresh time.Duration) *tokenVerifier {
+	return &tokenVerifier{
+		mode:    mode,
+		refresh: refresh,
+		apps:    make(map[int]appVerificationKeys),
+	}
+}
+
+// verifyLocally checks an access or client token against the cached keys of
+// its app and, in hybrid mode, the revocation list. Tokens that fail the
+// check are reported with ErrInvalidToken.
+func (a *Auth) verifyLocally(ctx context.Context, token string) (*TokenClaims, error) {
+	var unverified TokenClaims
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &unverified)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	// ID tokens are signed with the same keys but carry no app_id.
+	if unverified.AppID == 0 {
+		return nil, ErrInvalidToken
+	}
+	kid, _ := parsed.Header["kid"].(string)
+
+	keys, err := a.verificationKeys(ctx, unverified.AppID, kid)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	claims, err := DecodeToken(keys.secret, keys.keys, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.UID == 0 && claims.ClientID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	if a.verifier.mode == VerificationHybrid {
+		revoked, err := a.isRevoked(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return claims, nil
+}
+
+// verificationKeys returns the cached keys of the app, reloading them when
+// they are stale or do not contain kid.
+func (a *Auth) verificationKeys(ctx context.Context, appID int, kid string) (appVerificationKeys, error) {
+	v := a.verifier
+	now := time.Now()
+
+	v.appsMu.Lock()
+	cached, ok := v.apps[appID]
+	v.appsMu.Unlock()
+
+	if ok && now.Sub(cached.loadedAt) < v.refresh {
+		if _, err := cached.keys.Key(kid); kid == "" || err == nil {
+			return cached, nil
+		}
+		// The app may have rotated to a key the cache does not know yet.
+		if now.Sub(cached.loadedAt) < keyReloadInterval {
+			return cached, nil
+		}
+	}
+
+	app, err := a.app(ctx, appID)
+	if err != nil {
+		return appVerificationKeys{}, err
+	}
+
+	keys, err := a.appKeys(ctx, app)
+	if err != nil {
+		return appVerificationKeys{}, err
+	}
+
+	cached = appVerificationKeys{secret: app.Secret, keys: keys, loadedAt: now}
+
+	v.appsMu.Lock()
+	v.apps[appID] = cached
+	v.appsMu.Unlock()
+
+	return cached, nil
+}
+
+// isRevoked looks the token up in the revocation list, reloading the list
+// first when it is stale.
+func (a *Auth) isRevoked(ctx context.Context, token string) (bool, error) {
+	v := a.verifier
+
+	v.revokedMu.RLock()
+	stale := time.Since(v.loadedAt) >= v.refresh
+	loaded := v.revoked != nil
+	v.revokedMu.RUnlock()
+
+	if stale {
+		// Until the first load succeeds there is nothing to fall back on.
+		if !loaded {
+			v.loading.Lock()
+			err := a.loadRevokedTokens(ctx)
+			v.loading.Unlock()
+			if err != nil {
+				return false, err
+			}
+		} else if v.loading.TryLock() {
+			if err := a.loadRevokedTokens(ctx); err != nil {
+				a.log.Error("failed to reload revoked tokens", sl.Err(err))
+			}
+			v.loading.Unlock()
+		}
+	}
+
+	hash := sha256.Sum256([]byte(token))
+
+	v.revokedMu.RLock()
+	_, revoked := v.revoked[hash]
+	v.revokedMu.RUnlock()
+
+	return revoked, nil
+}
+
+// loadRevokedTokens replaces the revocation list unless another request
+// reloaded it in the meantime. The caller holds v.loading.
+func (a *Auth) loadRevokedTokens(ctx context.Context) error {
+	v := a.verifier
+
+	v.revokedMu.RLock()
+	fresh := time.Since(v.loadedAt) < v.refresh
+	v.revokedMu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	started := time.Now()
+
+	hashes, err := a.authProvider.RevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[[sha256.Size]byte]struct{}, len(hashes))
+	for _, hash := range hashes {
+		var key [sha256.Size]byte
+		copy(key[:], hash)
+		revoked[key] = struct{}{}
+	}
+
+	v.revokedMu.Lock()
+	v.revoked = revoked
+	if !v.revokedAt.After(started) {
+		v.loadedAt = started
+	}
+	v.revokedMu.Unlock()
+
+	return nil
+}
+
+// tokensRevoked makes this instance reload the revocation list on the next
+// check. Other instances pick revocations up within the refresh interval.
+func (a *Auth) tokensRevoked() {
+	if a.verifier == nil {
+		return
+	}
+
+	a.verifier.revokedMu.Lock()
+	a.verifier.revokedAt = time.Now()
+	a.verifier.loadedAt = time.Time{}
+	a.verifier.revokedMu.Unlock()
+}
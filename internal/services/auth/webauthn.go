@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/domain/storage"
+	"sso/internal/sl"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrWebAuthnDisabled       = errors.New("webauthn is not configured")
+	ErrInvalidWebAuthnSession = errors.New("invalid or expired webauthn session")
+	ErrInvalidCredential      = errors.New("invalid webauthn credential")
+)
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the decimal user id, which lets discoverable logins find the
+// user from the assertion alone.
+type webAuthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.user.ID, 10))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	if u.user.Fname == "" && u.user.Lname == "" {
+		return u.user.Email
+	}
+	return u.user.Fname + " " + u.user.Lname
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+// BeginWebAuthnRegistration starts registering a passkey for the user. The
+// options go to navigator.credentials.create(); the session id must be
+// passed back to FinishWebAuthnRegistration.
+func (a *Auth) BeginWebAuthnRegistration(ctx context.Context, userID int64) (string, *protocol.CredentialCreation, error) {
+	const op = "Auth.BeginWebAuthnRegistration"
+
+	if a.webAuthn == nil {
+		return "", nil, fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	user, err := a.webAuthnUser(ctx, userID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, c := range user.credentials {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	options, session, err := a.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessionID, err := a.saveWebAuthnSession(ctx, userID, storage.WebAuthnRegistration, session)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessionID, options, nil
+}
+
+// FinishWebAuthnRegistration verifies the response of the authenticator
+// and stores the new passkey.
+func (a *Auth) FinishWebAuthnRegistration(ctx context.Context, userID int64, sessionID string, response io.Reader) error {
+	const op = "Auth.FinishWebAuthnRegistration"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	if a.webAuthn == nil {
+		return fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	session, sessionUserID, err := a.consumeWebAuthnSession(ctx, sessionID, storage.WebAuthnRegistration)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if sessionUserID != userID {
+		return fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnSession)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", op, ErrInvalidCredential, err)
+	}
+
+	user, err := a.webAuthnUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	credential, err := a.webAuthn.CreateCredential(user, session, parsed)
+	if err != nil {
+		log.Warn("passkey registration rejected", sl.Err(err))
+
+		return fmt.Errorf("%s: %w: %v", op, ErrInvalidCredential, err)
+	}
+
+	if err := a.authProvider.SaveWebAuthnCredential(ctx, fromWebAuthnCredential(userID, credential)); err != nil {
+		if errors.Is(err, storage.ErrCredentialExists) {
+			return fmt.Errorf("%s: %w: %v", op, ErrInvalidCredential, err)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("passkey registered")
+
+	return nil
+}
+
+// BeginWebAuthnLogin starts a passkey login. With an email only that user's
+// passkeys are allowed; without one the authenticator offers its
+// discoverable credentials. The options go to navigator.credentials.get().
+// Unknown emails and users without passkeys get options that look the same
+// but allow a credential that does not exist.
+func (a *Auth) BeginWebAuthnLogin(ctx context.Context, email string) (string, *protocol.CredentialAssertion, error) {
+	const op = "Auth.BeginWebAuthnLogin"
+
+	if a.webAuthn == nil {
+		return "", nil, fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	var (
+		userID  int64
+		options *protocol.CredentialAssertion
+		session *webauthn.SessionData
+		err     error
+	)
+
+	if email == "" {
+		options, session, err = a.webAuthn.BeginDiscoverableLogin()
+	} else {
+		var user *webAuthnUser
+		user, err = a.webAuthnUserByEmail(ctx, email)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(user.credentials) == 0 {
+			// Answer like for a user with a passkey, so the response does
+			// not tell which emails are registered. The session can never
+			// be finished.
+			user = a.decoyWebAuthnUser(email)
+		}
+		userID = user.user.ID
+
+		options, session, err = a.webAuthn.BeginLogin(user)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessionID, err := a.saveWebAuthnSession(ctx, userID, storage.WebAuthnLogin, session)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessionID, options, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion and issues the same tokens as
+// Login. A passkey is a strong credential on its own, so no second factor
+// is asked for.
+func (a *Auth) FinishWebAuthnLogin(
+	ctx context.Context,
+	sessionID string,
+	appID int,
+	response io.Reader,
+) (models.TokenPair, error) {
+	const op = "Auth.FinishWebAuthnLogin"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appID),
+	)
+
+	if a.webAuthn == nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	session, userID, err := a.consumeWebAuthnSession(ctx, sessionID, storage.WebAuthnLogin)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w: %v", op, ErrInvalidCredential, err)
+	}
+
+	var (
+		user       *webAuthnUser
+		credential *webauthn.Credential
+	)
+
+	if userID != 0 {
+		user, err = a.webAuthnUser(ctx, userID)
+		if err != nil {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		credential, err = a.webAuthn.ValidateLogin(user, session, parsed)
+	} else {
+		credential, err = a.webAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			id, err := strconv.ParseInt(string(userHandle), 10, 64)
+			if err != nil {
+				return nil, ErrInvalidCredential
+			}
+
+			user, err = a.webAuthnUser(ctx, id)
+			return user, err
+		}, session, parsed)
+	}
+	if err != nil {
+		log.Warn("passkey assertion rejected", sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w: %v", op, ErrInvalidCredential, err)
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log.Warn("passkey sign counter went backwards, authenticator may be cloned",
+			slog.Int64("user_id", user.user.ID),
+		)
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w: sign counter did not increase", op, ErrInvalidCredential)
+	}
+
+	if err := a.authProvider.UpdateWebAuthnCredential(ctx, fromWebAuthnCredential(user.user.ID, credential)); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if a.requireActivation && !user.user.Activated {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrUserNotActivated)
+	}
+
+	app, err := a.app(ctx, appID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkMembership(ctx, app, user.user.ID); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := a.issueTokens(ctx, user.user, app, "", "")
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with passkey", slog.Int64("user_id", user.user.ID))
+
+	return pair, nil
+}
+
+func (a *Auth) webAuthnUser(ctx context.Context, userID int64) (*webAuthnUser, error) {
+	user, err := a.authProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := a.authProvider.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, c := range stored {
+		credentials = append(credentials, toWebAuthnCredential(c))
+	}
+
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// webAuthnUserByEmail returns the user with the email and their passkeys,
+// or a user without passkeys if there is no such user.
+func (a *Auth) webAuthnUserByEmail(ctx context.Context, email string) (*webAuthnUser, error) {
+	user, err := a.authProvider.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return &webAuthnUser{}, nil
+		}
+
+		return nil, err
+	}
+
+	return a.webAuthnUser(ctx, user.ID)
+}
+
+// decoyWebAuthnUser returns a user with a single made up passkey. The
+// credential id is derived from the email, so asking twice for the same
+// email gets the same allowed credential, as for a real user. The user id
+// is 0 while the session names a user handle, which FinishWebAuthnLogin
+// always rejects.
+func (a *Auth) decoyWebAuthnUser(email string) *webAuthnUser {
+	mac := hmac.New(sha256.New, a.webAuthnDecoyKey)
+	mac.Write([]byte(email))
+
+	return &webAuthnUser{
+		user: models.User{Email: email},
+		credentials: []webauthn.Credential{{
+			ID:        mac.Sum(nil),
+			Transport: []protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid},
+		}},
+	}
+}
+
+func (a *Auth) saveWebAuthnSession(
+	ctx context.Context,
+	userID int64,
+	kind string,
+	session *webauthn.SessionData,
+) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.authProvider.SaveWebAuthnSession(ctx, id, models.WebAuthnSession{
+		UserID: userID,
+		Kind:   kind,
+		Data:   data,
+		Expiry: time.Now().Add(a.webAuthnSessionTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (a *Auth) consumeWebAuthnSession(ctx context.Context, id string, kind string) (webauthn.SessionData, int64, error) {
+	stored, err := a.authProvider.ConsumeWebAuthnSession(ctx, id, kind)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return webauthn.SessionData{}, 0, ErrInvalidWebAuthnSession
+		}
+
+		return webauthn.SessionData{}, 0, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session); err != nil {
+		return webauthn.SessionData{}, 0, err
+	}
+
+	return session, stored.UserID, nil
+}
+
+func toWebAuthnCredential(c models.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+	for _, t := range c.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(t))
+	}
+
+	return webauthn.Credential{
+		ID:              c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: c.BackupEligible,
+			BackupState:    c.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    c.AAGUID,
+			SignCount: c.SignCount,
+		},
+	}
+}
+
+func fromWebAuthnCredential(userID int64, c *webauthn.Credential) models.WebAuthnCredential {
+	transports := make([]string, 0, len(c.Transport))
+	for _, t := range c.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return models.WebAuthnCredential{
+		ID:              c.ID,
+		UserID:          userID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transports:      transports,
+		AAGUID:          c.Authenticator.AAGUID,
+		SignCount:       c.Authenticator.SignCount,
+		BackupEligible:  c.Flags.BackupEligible,
+		BackupState:     c.Flags.BackupState,
+	}
+}
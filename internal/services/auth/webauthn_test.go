@@ -0,0 +1,322 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"io"
+	"sso/internal/services/auth"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "sso.test"
+	testOrigin = "https://sso.test"
+)
+
+// virtualAuthenticator is a software passkey: one ES256 credential with
+// "none" attestation, answering the options of the ceremonies like a
+// browser and authenticator would.
+type virtualAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newVirtualAuthenticator(t *testing.T) *virtualAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+
+	return &virtualAuthenticator{key: key, credentialID: id}
+}
+
+// create answers navigator.credentials.create().
+func (v *virtualAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) io.Reader {
+	t.Helper()
+
+	v.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: v.key.X.FillBytes(make([]byte, 32)),
+		YCoord: v.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authData := v.authData(0x45) // user present, user verified, attested data
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(v.credentialID)))
+	authData = append(authData, v.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v.response(t, map[string]any{
+		"clientDataJSON":    clientData(t, "webauthn.create", options.Response.Challenge),
+		"attestationObject": b64(attestation),
+		"transports":        []string{"internal", "hybrid"},
+	})
+}
+
+// get answers navigator.credentials.get().
+func (v *virtualAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) io.Reader {
+	t.Helper()
+
+	v.signCount++
+	authData := v.authData(0x05) // user present, user verified
+	clientDataJSON := clientData(t, "webauthn.get", options.Response.Challenge)
+
+	raw, _ := base64.RawURLEncoding.DecodeString(clientDataJSON)
+	clientDataHash := sha256.Sum256(raw)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, v.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v.response(t, map[string]any{
+		"clientDataJSON":    clientDataJSON,
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(v.userHandle),
+	})
+}
+
+func (v *virtualAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, v.signCount)
+}
+
+func (v *virtualAuthenticator) response(t *testing.T, response map[string]any) io.Reader {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]any{
+		"id":       b64(v.credentialID),
+		"rawId":    b64(v.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(body)
+}
+
+func clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b64(data)
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newWebAuthnAuth(t *testing.T) (*auth.Auth, int) {
+	t.Helper()
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "SSO",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestAuth(t, auth.WithWebAuthn(w, time.Minute))
+}
+
+// registerPasskey registers a new passkey for the user.
+func registerPasskey(t *testing.T, a *auth.Auth, userID int64) *virtualAuthenticator {
+	t.Helper()
+
+	ctx := context.Background()
+	authenticator := newVirtualAuthenticator(t)
+
+	sessionID, options, err := a.BeginWebAuthnRegistration(ctx, userID)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration: %v", err)
+	}
+	if err := a.FinishWebAuthnRegistration(ctx, userID, sessionID, authenticator.create(t, options)); err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+
+	return authenticator
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name  string
+		email string
+	}{
+		{name: "with email", email: "passkey@example.com"},
+		{name: "discoverable", email: ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, appID := newWebAuthnAuth(t)
+			userID := registerUser(t, a, "passkey@example.com")
+			authenticator := registerPasskey(t, a, userID)
+
+			sessionID, options, err := a.BeginWebAuthnLogin(ctx, tt.email)
+			if err != nil {
+				t.Fatalf("BeginWebAuthnLogin: %v", err)
+			}
+
+			pair, err := a.FinishWebAuthnLogin(ctx, sessionID, appID, authenticator.get(t, options))
+			if err != nil {
+				t.Fatalf("FinishWebAuthnLogin: %v", err)
+			}
+
+			claims, err := a.VerifyToken(ctx, pair.AccessToken)
+			if err != nil {
+				t.Fatalf("VerifyToken: %v", err)
+			}
+			if int64(claims.UID) != userID {
+				t.Errorf("token of user %d, want %d", claims.UID, userID)
+			}
+		})
+	}
+}
+
+func TestFinishWebAuthnLoginRejectsSessionReuse(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newWebAuthnAuth(t)
+	userID := registerUser(t, a, "passkey@example.com")
+	authenticator := registerPasskey(t, a, userID)
+
+	sessionID, options, err := a.BeginWebAuthnLogin(ctx, "passkey@example.com")
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	if _, err := a.FinishWebAuthnLogin(ctx, sessionID, appID, authenticator.get(t, options)); err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+
+	_, err = a.FinishWebAuthnLogin(ctx, sessionID, appID, authenticator.get(t, options))
+	if !errors.Is(err, auth.ErrInvalidWebAuthnSession) {
+		t.Errorf("reused session: got %v, want %v", err, auth.ErrInvalidWebAuthnSession)
+	}
+}
+
+func TestFinishWebAuthnLoginRejectsClonedAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newWebAuthnAuth(t)
+	userID := registerUser(t, a, "passkey@example.com")
+	authenticator := registerPasskey(t, a, userID)
+
+	login := func() error {
+		sessionID, options, err := a.BeginWebAuthnLogin(ctx, "")
+		if err != nil {
+			t.Fatalf("BeginWebAuthnLogin: %v", err)
+		}
+
+		_, err = a.FinishWebAuthnLogin(ctx, sessionID, appID, authenticator.get(t, options))
+		return err
+	}
+
+	if err := login(); err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+
+	// A copy of the authenticator answers with the same counter again.
+	authenticator.signCount--
+
+	if err := login(); !errors.Is(err, auth.ErrInvalidCredential) {
+		t.Errorf("repeated sign count: got %v, want %v", err, auth.ErrInvalidCredential)
+	}
+}
+
+func TestBeginWebAuthnLoginDoesNotRevealEmails(t *testing.T) {
+	ctx := context.Background()
+	a, appID := newWebAuthnAuth(t)
+	registerPasskey(t, a, registerUser(t, a, "passkey@example.com"))
+	registerUser(t, a, "password@example.com")
+
+	_, registered, err := a.BeginWebAuthnLogin(ctx, "passkey@example.com")
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+
+	for _, email := range []string{"password@example.com", "unknown@example.com"} {
+		sessionID, options, err := a.BeginWebAuthnLogin(ctx, email)
+		if err != nil {
+			t.Fatalf("BeginWebAuthnLogin(%s): %v", email, err)
+		}
+
+		allowed := options.Response.AllowedCredentials
+		want := registered.Response.AllowedCredentials
+		if len(allowed) != len(want) || len(allowed[0].CredentialID) != len(want[0].CredentialID) ||
+			len(allowed[0].Transport) != len(want[0].Transport) {
+			t.Errorf("%s: allowed credentials %+v do not look like %+v", email, allowed, want)
+		}
+
+		_, again, err := a.BeginWebAuthnLogin(ctx, email)
+		if err != nil {
+			t.Fatalf("BeginWebAuthnLogin(%s): %v", email, err)
+		}
+		if !bytes.Equal(again.Response.AllowedCredentials[0].CredentialID, allowed[0].CredentialID) {
+			t.Errorf("%s: allowed credential changed between logins", email)
+		}
+
+		// Even a real passkey cannot finish the made up login.
+		impostor := newVirtualAuthenticator(t)
+		impostor.credentialID = allowed[0].CredentialID
+		impostor.userHandle = []byte("0")
+
+		_, err = a.FinishWebAuthnLogin(ctx, sessionID, appID, impostor.get(t, options))
+		if !errors.Is(err, auth.ErrInvalidCredential) {
+			t.Errorf("%s: finish got %v, want %v", email, err, auth.ErrInvalidCredential)
+		}
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"errors"
 	"fmt"
 	ssov1 "github.com/DarkhanOmirbay/proto/proto/gen/go/sso"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"sso/internal/domain/models"
+	"sso/internal/password"
 	"sso/internal/sl"
 	"strconv"
 	"time"
@@ -19,21 +19,38 @@ type UserProvider interface {
 	UpdateUser(ctx context.Context, user models.User) error
 	DeleteUser(ctx context.Context, userId int64) error
 }
+
+// ActivationSender mails an activation token to a user whose email has to
+// be verified again.
+type ActivationSender interface {
+	SendActivation(ctx context.Context, userID int64, email string) error
+}
+
 type User struct {
 	log          *slog.Logger
 	userProvider UserProvider
 	tokenTTL     time.Duration
+	passwords    *password.Policy
+	hasher       models.PasswordHasher
+	activations  ActivationSender
 }
 
 func New(
-	log *slog.Logger, usreProvider UserProvider, tokenTTL time.Duration) *User {
+	log *slog.Logger, usreProvider UserProvider, tokenTTL time.Duration, passwords *password.Policy, hasher models.PasswordHasher,
+	activations ActivationSender) *User {
 	return &User{
 		log:          log,
 		userProvider: usreProvider,
 		tokenTTL:     tokenTTL,
+		passwords:    passwords,
+		hasher:       hasher,
+		activations:  activations,
 	}
 }
-func (u *User) EditProfile(ctx context.Context, userId int64, user ssov1.User) (string, *ssov1.User, error) {
+
+// EditProfile updates the fields set in user. Changing the email makes the
+// account unverified again until the new address is activated.
+func (u *User) EditProfile(ctx context.Context, userId int64, user *ssov1.User) (string, *ssov1.User, error) {
 	const op = "User.EditProfile"
 
 	log := u.log.With(slog.String("op", op),
@@ -54,23 +71,36 @@ func (u *User) EditProfile(ctx context.Context, userId int64, user ssov1.User) (
 	if user.Lname != "" {
 		updatedUser.Lname = user.Lname
 	}
-	if user.Email != "" {
+	emailChanged := user.Email != "" && user.Email != updatedUser.Email
+	if emailChanged {
 		updatedUser.Email = user.Email
+		updatedUser.Activated = false
 	}
 	if user.Password != "" {
-		passHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-		if err != nil {
+		if err := u.passwords.Validate(user.Password, updatedUser.Email, updatedUser.Fname, updatedUser.Lname); err != nil {
+			log.Info("password rejected", sl.Err(err))
+
+			return "", nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := updatedUser.PasswordHash.Set(user.Password, u.hasher); err != nil {
 			log.Error("failed to generate password hash", sl.Err(err))
 
 			return "", nil, fmt.Errorf("%s: %w", op, err)
 		}
-		updatedUser.PasswordHash.Hash = passHash
 	}
 	err = u.userProvider.UpdateUser(ctx, *updatedUser)
 	if err != nil {
 		return "", nil, fmt.Errorf("%s: %w", op, err)
 	}
-	return "user updated succesfully", &user, nil
+	if emailChanged && u.activations != nil {
+		// The profile is saved either way; a lost mail can be sent again
+		// by changing the email once more.
+		if err := u.activations.SendActivation(ctx, userId, updatedUser.Email); err != nil {
+			log.Error("failed to send activation token", sl.Err(err))
+		}
+	}
+	return "user updated succesfully", user, nil
 }
 func (u *User) DeleteAccount(ctx context.Context, userId int64) (string, error) {
 	err := u.userProvider.DeleteUser(ctx, userId)
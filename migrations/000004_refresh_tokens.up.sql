@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    hash      bytea PRIMARY KEY,
+    user_id   BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id    INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL,
+    expiry    TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    used      bool NOT NULL DEFAULT false,
+    revoked   bool NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens(family_id);
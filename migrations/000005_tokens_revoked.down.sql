@@ -0,0 +1,3 @@
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS family_id,
+    DROP COLUMN IF EXISTS revoked;
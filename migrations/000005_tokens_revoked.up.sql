@@ -0,0 +1,3 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS revoked   bool NOT NULL DEFAULT false;
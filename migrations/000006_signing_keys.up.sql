@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    kid         TEXT PRIMARY KEY,
+    app_id      INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    algorithm   TEXT NOT NULL,
+    private_key bytea NOT NULL,
+    active      bool NOT NULL DEFAULT false,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    retire_at   TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS signing_keys_active_idx ON signing_keys(app_id) WHERE active;
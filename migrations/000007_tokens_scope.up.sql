@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT 'authentication';
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens(user_id, scope);
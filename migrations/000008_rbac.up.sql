@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS roles
+(
+    id   INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id   INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles(name) VALUES ('user'), ('admin') ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions(name)
+VALUES ('users:read'), ('users:write'), ('users:delete'), ('roles:manage'), ('tokens:revoke')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions(role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles(user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = COALESCE(u.user_role, 'user')
+ON CONFLICT DO NOTHING;
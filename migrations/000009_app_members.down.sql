@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS app_user_roles;
+DROP TABLE IF EXISTS app_members;
+
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS open_membership;
@@ -0,0 +1,19 @@
+ALTER TABLE apps
+    ADD COLUMN IF NOT EXISTS open_membership bool NOT NULL DEFAULT true;
+
+CREATE TABLE IF NOT EXISTS app_members
+(
+    app_id     INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (app_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS app_user_roles
+(
+    app_id  INTEGER NOT NULL,
+    user_id BIGINT NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (app_id, user_id, role_id),
+    FOREIGN KEY (app_id, user_id) REFERENCES app_members(app_id, user_id) ON DELETE CASCADE
+);
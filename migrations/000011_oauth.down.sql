@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_codes;
+
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS redirect_uris,
+    DROP COLUMN IF EXISTS client_type;
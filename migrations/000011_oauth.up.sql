@@ -0,0 +1,24 @@
+ALTER TABLE apps
+    ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS client_type   TEXT NOT NULL DEFAULT 'confidential';
+
+CREATE TABLE IF NOT EXISTS oauth_codes
+(
+    hash                  bytea PRIMARY KEY,
+    app_id                INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    user_id               BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri          TEXT NOT NULL,
+    scope                 TEXT NOT NULL DEFAULT '',
+    code_challenge        TEXT NOT NULL DEFAULT '',
+    code_challenge_method TEXT NOT NULL DEFAULT '',
+    expiry                TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents
+(
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id     INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    scope      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, app_id)
+);
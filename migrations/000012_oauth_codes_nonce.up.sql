@@ -0,0 +1,2 @@
+ALTER TABLE oauth_codes
+    ADD COLUMN IF NOT EXISTS nonce TEXT NOT NULL DEFAULT '';
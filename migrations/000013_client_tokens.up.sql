@@ -0,0 +1,11 @@
+ALTER TABLE apps
+    ADD COLUMN IF NOT EXISTS client_scopes TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS client_tokens
+(
+    hash    bytea PRIMARY KEY,
+    app_id  INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    scope   TEXT NOT NULL DEFAULT '',
+    expiry  TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT false
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id      BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret       TEXT NOT NULL,
+    confirmed    bool NOT NULL DEFAULT false,
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes
+(
+    hash    bytea PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used    bool NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes(user_id);
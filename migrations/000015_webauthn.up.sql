@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id               bytea PRIMARY KEY,
+    user_id          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    public_key       bytea NOT NULL,
+    attestation_type TEXT NOT NULL DEFAULT '',
+    transports       TEXT[] NOT NULL DEFAULT '{}',
+    aaguid           bytea,
+    sign_count       BIGINT NOT NULL DEFAULT 0,
+    backup_eligible  bool NOT NULL DEFAULT false,
+    backup_state     bool NOT NULL DEFAULT false,
+    created_at       TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_used_at     TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials(user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_sessions
+(
+    hash    bytea PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    kind    TEXT NOT NULL,
+    data    bytea NOT NULL,
+    expiry  TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    key           TEXT PRIMARY KEY,
+    failures      INTEGER NOT NULL DEFAULT 0,
+    last_failure  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    blocked_until TIMESTAMP(0) WITH TIME ZONE
+);
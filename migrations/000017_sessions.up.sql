@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           TEXT PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id       INTEGER NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    ip           TEXT NOT NULL DEFAULT '',
+    user_agent   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    expiry       TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS access_token_ttl_seconds,
+    DROP COLUMN IF EXISTS refresh_token_ttl_seconds;
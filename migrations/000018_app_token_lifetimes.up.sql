@@ -0,0 +1,3 @@
+ALTER TABLE apps
+    ADD COLUMN IF NOT EXISTS access_token_ttl_seconds  INTEGER,
+    ADD COLUMN IF NOT EXISTS refresh_token_ttl_seconds INTEGER;
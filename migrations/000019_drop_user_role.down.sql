@@ -0,0 +1,11 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS user_role VARCHAR(50);
+
+UPDATE users u
+SET user_role = CASE
+        WHEN EXISTS (
+            SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+            WHERE ur.user_id = u.id AND r.name = 'admin'
+        ) THEN 'admin'
+        ELSE 'user'
+    END;
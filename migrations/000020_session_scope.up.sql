@@ -0,0 +1,2 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';